@@ -0,0 +1,146 @@
+package v1alpha1
+
+import (
+	commonv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types specific to a Repo.
+const (
+	// TypeSignaturesVerified reports whether the origin commits are signed by a trusted key.
+	TypeSignaturesVerified commonv1.ConditionType = "SignaturesVerified"
+
+	// TypeTargetPushed reports whether the last commit was pushed to the target repo.
+	TypeTargetPushed commonv1.ConditionType = "TargetPushed"
+
+	// TypeValuesValid reports whether the template values satisfy the schema shipped in the origin repo.
+	TypeValuesValid commonv1.ConditionType = "ValuesValid"
+
+	// TypeContentInSync reports whether the content of the target repo matches the render of the origin repo.
+	TypeContentInSync commonv1.ConditionType = "ContentInSync"
+)
+
+// Reasons specific to a Repo.
+const (
+	ReasonSignaturesTrusted  commonv1.ConditionReason = "SignaturesTrusted"
+	ReasonUnsignedCommit     commonv1.ConditionReason = "UnsignedCommit"
+	ReasonUntrustedSignature commonv1.ConditionReason = "UntrustedSignature"
+	ReasonInvalidKeyring     commonv1.ConditionReason = "InvalidKeyring"
+	ReasonHistoryRewritten   commonv1.ConditionReason = "HistoryRewritten"
+
+	ReasonPushSucceeded commonv1.ConditionReason = "PushSucceeded"
+	ReasonPushRejected  commonv1.ConditionReason = "PushRejected"
+	ReasonStaleLease    commonv1.ConditionReason = "StaleLease"
+
+	ReasonSchemaSatisfied commonv1.ConditionReason = "SchemaSatisfied"
+	ReasonValuesInvalid   commonv1.ConditionReason = "ValuesInvalid"
+	ReasonInvalidSchema   commonv1.ConditionReason = "InvalidSchema"
+
+	ReasonContentMatches commonv1.ConditionReason = "ContentMatches"
+	ReasonContentDrifted commonv1.ConditionReason = "ContentDrifted"
+)
+
+// SignaturesTrusted returns a condition that indicates the origin commits are
+// signed by a trusted key.
+func SignaturesTrusted() commonv1.Condition {
+	return commonv1.Condition{
+		Type:               TypeSignaturesVerified,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonSignaturesTrusted,
+	}
+}
+
+// SignaturesTrustedAtTip returns a condition that indicates only the tip
+// commit could be verified because the last synchronized commit is no longer
+// in the origin history.
+func SignaturesTrustedAtTip(since string) commonv1.Condition {
+	return commonv1.Condition{
+		Type:               TypeSignaturesVerified,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonHistoryRewritten,
+		Message:            "commit " + since + " is not in the origin history, only the tip commit was verified",
+	}
+}
+
+// SignaturesNotTrusted returns a condition that indicates the origin commits
+// could not be verified against the trusted keyring.
+func SignaturesNotTrusted(reason commonv1.ConditionReason, err error) commonv1.Condition {
+	return commonv1.Condition{
+		Type:               TypeSignaturesVerified,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            err.Error(),
+	}
+}
+
+// PushSucceeded returns a condition that indicates the last commit was pushed
+// to the target repo.
+func PushSucceeded() commonv1.Condition {
+	return commonv1.Condition{
+		Type:               TypeTargetPushed,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonPushSucceeded,
+	}
+}
+
+// PushRejected returns a condition that indicates the target repo rejected
+// the push of the last commit.
+func PushRejected(reason commonv1.ConditionReason, err error) commonv1.Condition {
+	return commonv1.Condition{
+		Type:               TypeTargetPushed,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            err.Error(),
+	}
+}
+
+// ValuesValid returns a condition that indicates the template values satisfy
+// the schema shipped in the origin repo.
+func ValuesValid() commonv1.Condition {
+	return commonv1.Condition{
+		Type:               TypeValuesValid,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonSchemaSatisfied,
+	}
+}
+
+// ValuesInvalid returns a condition that indicates the template values could
+// not be validated against the schema shipped in the origin repo.
+func ValuesInvalid(reason commonv1.ConditionReason, err error) commonv1.Condition {
+	return commonv1.Condition{
+		Type:               TypeValuesValid,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            err.Error(),
+	}
+}
+
+// ContentInSync returns a condition that indicates the content of the target
+// repo matches the render of the origin repo.
+func ContentInSync() commonv1.Condition {
+	return commonv1.Condition{
+		Type:               TypeContentInSync,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonContentMatches,
+	}
+}
+
+// ContentDrifted returns a condition that indicates the content of the target
+// repo was changed after the last synchronization.
+func ContentDrifted(msg string) commonv1.Condition {
+	return commonv1.Condition{
+		Type:               TypeContentInSync,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonContentDrifted,
+		Message:            msg,
+	}
+}
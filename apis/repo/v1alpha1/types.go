@@ -5,6 +5,7 @@ import (
 	prv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
 	"github.com/krateoplatformops/provider-runtime/pkg/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 type RepoOpts struct {
@@ -44,7 +45,42 @@ type RepoOpts struct {
 	CloneFromBranch string `json:"cloneFromBranch,omitempty"`
 }
 
+type VerifySignaturesOpts struct {
+	// Mode: Possible values are: `tip`, `all`. `tip` verifies only the latest commit of the origin branch; `all` verifies every commit since `status.originCommitId` (only the latest commit on first synchronization, or when `status.originCommitId` is no longer in the origin history, e.g. after a force-push)
+	// +kubebuilder:validation:Enum=tip;all
+	// +kubebuilder:default:=tip
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// KeyringConfigMapRef: reference to a configmap key that contains the trusted keys. Keys can be armored OpenPGP public keys or SSH public keys in the `authorized_keys` or `allowed_signers` format.
+	// +optional
+	KeyringConfigMapRef *commonv1.ConfigMapKeySelector `json:"keyringConfigMapRef,omitempty"`
+
+	// KeyringSecretRef: reference to a secret key that contains the trusted keys. Same format of `keyringConfigMapRef`.
+	// +optional
+	KeyringSecretRef *commonv1.SecretKeySelector `json:"keyringSecretRef,omitempty"`
+}
+
 type FromRepoOpts struct {
+	// VerifySignatures: if set, the provider refuses to synchronize origin commits not signed by a trusted key
+	// +optional
+	VerifySignatures *VerifySignaturesOpts `json:"verifySignatures,omitempty"`
+
+	// ValuesSchemaPath: path of the JSON Schema used to validate the template values and to apply their defaults, relative to the root of the repository. Validation is skipped if the file does not exist. The file is never copied to the target repo.
+	// +kubebuilder:default:=".krateo/values.schema.json"
+	// +optional
+	ValuesSchemaPath string `json:"valuesSchemaPath,omitempty"`
+
+	// RulesPath: path of the manifest with the rules including or excluding files depending on the template values, relative to the root of the repository. No rule is applied if the file does not exist. The file is never copied to the target repo.
+	// +kubebuilder:default:=".krateo/rules.yaml"
+	// +optional
+	RulesPath string `json:"rulesPath,omitempty"`
+
+	// PartialsPath: path of the directory with the template partials, relative to the root of the repository. The directory is never copied to the target repo.
+	// +kubebuilder:default:=".krateo/partials"
+	// +optional
+	PartialsPath string `json:"partialsPath,omitempty"`
+
 	// KrateoIgnorePath: path to the krateo ignore file, if not set the default is `/`, the root of the repository
 	// +kubebuilder:default:="/"
 	// +optional
@@ -53,6 +89,110 @@ type FromRepoOpts struct {
 	RepoOpts `json:",inline"`
 }
 
+type SigningKeyOpts struct {
+	// Format: format of the signing key. Possible values are: `openpgp`, `ssh`. `openpgp` requires an armored OpenPGP private key; `ssh` requires an OpenSSH private key and produces signatures in the git SSH signature format.
+	// +kubebuilder:validation:Enum=openpgp;ssh
+	// +kubebuilder:default:=openpgp
+	// +optional
+	Format string `json:"format,omitempty"`
+
+	// SecretRef: reference to a secret that contains the private key used to sign commits
+	SecretRef *commonv1.SecretKeySelector `json:"secretRef"`
+
+	// PassphraseRef: reference to a secret that contains the passphrase of the private key. Required if the private key is encrypted.
+	// +optional
+	PassphraseRef *commonv1.SecretKeySelector `json:"passphraseRef,omitempty"`
+}
+
+// ValuesSource: a source of template values. Exactly one of the fields must be set.
+// +kubebuilder:validation:XValidation:rule="has(self.configMapKeyRef) != has(self.secretKeyRef)",message="exactly one of configMapKeyRef and secretKeyRef must be set"
+type ValuesSource struct {
+	// ConfigMapKeyRef: reference to a configmap key holding the values
+	// +optional
+	ConfigMapKeyRef *commonv1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef: reference to a secret key holding the values
+	// +optional
+	SecretKeyRef *commonv1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// PathTemplatingOpts: options for the rendering of directory and file names.
+type PathTemplatingOpts struct {
+	// Delimiters: left and right delimiters used in directory and file names, separated by a space (e.g. `[[ ]]`)
+	// +kubebuilder:default:="{{ }}"
+	// +kubebuilder:validation:Pattern=`^\S+ \S+$`
+	// +optional
+	Delimiters string `json:"delimiters,omitempty"`
+
+	// SkipEmpty: If `true`, files and directories whose name renders to an empty string are not copied, which is useful for conditional files. If `false`, an empty name is an error.
+	// +kubebuilder:default:=false
+	// +optional
+	SkipEmpty bool `json:"skipEmpty,omitempty"`
+}
+
+// DelimitersOpts: template delimiters of the files matching some globs.
+type DelimitersOpts struct {
+	// Paths: globs of the files, relative to `fromRepo.path` (e.g. `charts/**/*.yaml`). A glob without `/` matches the file name in any directory (e.g. `*.yaml`).
+	// +kubebuilder:validation:MinItems=1
+	Paths []string `json:"paths"`
+
+	// Delimiters: left and right delimiters separated by a space (e.g. `[[ ]]`)
+	// +kubebuilder:validation:Pattern=`^\S+ \S+$`
+	Delimiters string `json:"delimiters"`
+}
+
+type ScheduleOpts struct {
+	// Cron: cron expression (minute, hour, day of month, month, day of week) of the times the updates can be applied, e.g. `0 2 * * 1-5`. Pending updates are applied once per scheduled time.
+	Cron string `json:"cron"`
+
+	// TimeZone: IANA name of the time zone of the cron expression, e.g. `Europe/Rome`
+	// +kubebuilder:default:=UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+type SyncWindow struct {
+	// Kind: Possible values are: `allow`, `deny`. Updates are never applied during a `deny` window and, if at least one `allow` window is defined, are applied only during `allow` windows.
+	// +kubebuilder:validation:Enum=allow;deny
+	Kind string `json:"kind"`
+
+	// Schedule: cron expression (minute, hour, day of month, month, day of week) of the start of the window, e.g. `0 22 * * *`
+	Schedule string `json:"schedule"`
+
+	// Duration: duration of the window, e.g. `2h` or `30m`
+	Duration metav1.Duration `json:"duration"`
+
+	// TimeZone: IANA name of the time zone of the schedule, e.g. `Europe/Rome`
+	// +kubebuilder:default:=UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+type ToRepoOpts struct {
+	// PushMode: Possible values are: `fastForwardOnly`, `force`, `forceWithLease`. `fastForwardOnly` never overwrites the remote branch; `force` always overwrites the remote branch; `forceWithLease` overwrites the remote branch only if it still points to `status.targetCommitId`.
+	// Use `force` and `forceWithLease` only for branches owned by the provider.
+	// +kubebuilder:validation:Enum=fastForwardOnly;force;forceWithLease
+	// +kubebuilder:default:=fastForwardOnly
+	// +optional
+	PushMode string `json:"pushMode,omitempty"`
+
+	// HistoryMode: Possible values are: `append`, `squash`. `append` adds a new commit on top of the branch at each synchronization; `squash` replaces the branch with a single orphan commit containing only the rendered output, pushed with lease on `status.targetCommitId` (or with `force` if `pushMode` is `force`).
+	// +kubebuilder:validation:Enum=append;squash
+	// +kubebuilder:default:=append
+	// +optional
+	HistoryMode string `json:"historyMode,omitempty"`
+
+	// ProtectedPaths: paths that are never written nor deleted by the provider, even if `override` is `true`, in `.gitignore` format relative to the root of the repository. They are added to the default ones, `.git`, `.github/workflows` and `CODEOWNERS`, which can be unprotected by negation (e.g. `!CODEOWNERS`); the `.git` directory is always protected.
+	// +optional
+	ProtectedPaths []string `json:"protectedPaths,omitempty"`
+
+	// SigningKey: if set, the commits pushed to the repository are signed with the referenced key
+	// +optional
+	SigningKey *SigningKeyOpts `json:"signingKey,omitempty"`
+
+	RepoOpts `json:",inline"`
+}
+
 // A RepoSpec defines the desired state of a Repo.
 type RepoSpec struct {
 	// FromRepo: repo origin to copy from
@@ -61,12 +201,48 @@ type RepoSpec struct {
 
 	// ToRepo: repo destination to copy to
 	// +immutable
-	ToRepo RepoOpts `json:"toRepo"`
+	ToRepo ToRepoOpts `json:"toRepo"`
 
 	// ConfigMapKeyRef: holds template values
 	// +optional
 	ConfigMapKeyRef *commonv1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
 
+	// ValuesFrom: ordered list of sources of template values, each one in JSON or YAML format.
+	// Values are deep-merged in this order: `configMapKeyRef`, `valuesFrom` (later sources take precedence), `values`.
+	// +optional
+	ValuesFrom []ValuesSource `json:"valuesFrom,omitempty"`
+
+	// Values: inline template values, they take precedence over `configMapKeyRef` and `valuesFrom`
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Values *runtime.RawExtension `json:"values,omitempty"`
+
+	// TemplateEngine: Possible values are: `mustache`, `gotemplate`. Engine used to render file contents and file names.
+	// `gotemplate` uses Go `text/template` with the Sprig functions (except the ones accessing the environment or the network, or producing random output) plus `toYaml`, `fromYaml` and `required`.
+	// +kubebuilder:validation:Enum=mustache;gotemplate
+	// +kubebuilder:default:=mustache
+	// +optional
+	TemplateEngine string `json:"templateEngine,omitempty"`
+
+	// Symlinks: Possible values are: `skip`, `preserve`, `dereference`. `skip` does not copy symbolic links; `preserve` recreates them in the target repo; `dereference` copies the content of the file or directory they point to. Links pointing outside of the repository are rejected.
+	// +kubebuilder:validation:Enum=skip;preserve;dereference
+	// +kubebuilder:default:=skip
+	// +optional
+	Symlinks string `json:"symlinks,omitempty"`
+
+	// StrictTemplating: If `true`, the synchronization fails if a template uses a variable not defined in the values, instead of rendering it as an empty string. Nothing is committed and the error lists each missing variable with its file and line.
+	// +kubebuilder:default:=false
+	// +optional
+	StrictTemplating bool `json:"strictTemplating,omitempty"`
+
+	// Delimiters: template delimiters of the file contents by glob, the first entry matching a file applies. The files not matching any entry use the default delimiters `{{ }}`, and with Mustache a set delimiter tag at the beginning of a file overrides them.
+	// +optional
+	Delimiters []DelimitersOpts `json:"delimiters,omitempty"`
+
+	// PathTemplating: options for the rendering of directory and file names
+	// +optional
+	PathTemplating *PathTemplatingOpts `json:"pathTemplating,omitempty"`
+
 	// Insecure: Insecure is useful with hand made SSL certs (default: false)
 	// +optional
 	Insecure bool `json:"insecure,omitempty"`
@@ -81,6 +257,25 @@ type RepoSpec struct {
 	// +optional
 	EnableUpdate bool `json:"enableUpdate,omitempty"`
 
+	// DriftDetection: Possible values are: `commit`, `content`. `commit` considers the target repo up-to-date as long as `status.targetCommitId` is in the history of the target branch; `content` also renders the origin repo at `status.originCommitId` and compares the result with the content of the target branch under `toRepo.path`, reporting any difference in the `ContentInSync` condition. The content is re-applied only if both `enableUpdate` and `override` are `true`.
+	// +kubebuilder:validation:Enum=commit;content
+	// +kubebuilder:default:=commit
+	// +optional
+	DriftDetection string `json:"driftDetection,omitempty"`
+
+	// Schedule: if set, updates of the target repo are deferred to the scheduled times. The initial synchronization is not deferred.
+	// +optional
+	Schedule *ScheduleOpts `json:"schedule,omitempty"`
+
+	// SyncWindows: time windows allowing or denying the updates of the target repo, outside of the allowed windows the updates are deferred. The initial synchronization is not deferred. The annotation `git.krateo.io/sync-windows-override: "true"` ignores both `schedule` and `syncWindows`.
+	// +optional
+	SyncWindows []SyncWindow `json:"syncWindows,omitempty"`
+
+	// DryRun: If `true`, the provider clones and renders the repositories but does not commit nor push anything. The changes that would be pushed are summarized in `status.dryRun` and their unified diff is stored in a configmap. It works regardless of `enableUpdate`.
+	// +kubebuilder:default:=false
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+
 	// Override: If `true`, the provider will override the existing files in the destination repository with the files from the source repository.
 	// If `false`, the provider will only add new files and update existing files in the destination repository.
 	// If not set, the provider will use the default behavior of adding new files.
@@ -105,6 +300,122 @@ type RepoStatus struct {
 
 	// OriginBranch: branch where commit was done
 	OriginBranch string `json:"originBranch,omitempty"`
+
+	// OriginRef: resolved reference of the origin repo that was synchronized, e.g. `refs/heads/main`
+	// +optional
+	OriginRef string `json:"originRef,omitempty"`
+
+	// ValuesHash: hash of the effective template values used for the last synchronization
+	ValuesHash string `json:"valuesHash,omitempty"`
+
+	// ObservedGeneration: generation of the resource that was last synchronized or observed up-to-date
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastAttemptTime: time of the last synchronization attempt, successful or not
+	// +optional
+	LastAttemptTime *metav1.Time `json:"lastAttemptTime,omitempty"`
+
+	// LastSyncTime: time of the last synchronization of the target repo
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// NextSyncTime: earliest time the deferred update of the target repo is allowed by `schedule` and `syncWindows`, unset if no update is deferred
+	// +optional
+	NextSyncTime *metav1.Time `json:"nextSyncTime,omitempty"`
+
+	// LastCommit: files changed by the last commit pushed to the target repo
+	// +optional
+	LastCommit *CommitStats `json:"lastCommit,omitempty"`
+
+	// Durations: durations of the phases of the last synchronization
+	// +optional
+	Durations *SyncDurations `json:"durations,omitempty"`
+
+	// LastHandledSyncRequest: value of the `git.krateo.io/sync-requested-at` annotation when the last synchronization it requested succeeded
+	// +optional
+	LastHandledSyncRequest string `json:"lastHandledSyncRequest,omitempty"`
+
+	// DryRun: result of the last dry run, if `spec.dryRun` is `true`
+	// +optional
+	DryRun *DryRunStatus `json:"dryRun,omitempty"`
+}
+
+// CommitStats: number of files changed by a commit.
+type CommitStats struct {
+	// Added: number of files added
+	Added int `json:"added"`
+
+	// Modified: number of files modified, including the ones whose only change is the mode
+	Modified int `json:"modified"`
+
+	// Deleted: number of files deleted
+	Deleted int `json:"deleted"`
+}
+
+// SyncDurations: durations of the phases of a synchronization.
+type SyncDurations struct {
+	// Clone: time spent cloning the origin and target repos
+	Clone metav1.Duration `json:"clone"`
+
+	// Render: time spent copying and rendering the files of the origin repo
+	Render metav1.Duration `json:"render"`
+
+	// Push: time spent committing and pushing to the target repo, including retries
+	// +optional
+	Push metav1.Duration `json:"push,omitempty"`
+}
+
+// DryRunStatus: changes that would be pushed to the target repo.
+type DryRunStatus struct {
+	// ObservedGeneration: generation of the resource the dry run was computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// OriginCommitId: commit identifier of the origin repo that was rendered
+	OriginCommitId string `json:"originCommitId,omitempty"`
+
+	// TargetCommitId: commit identifier of the target repo the changes are computed against, empty if the target branch does not exist
+	TargetCommitId string `json:"targetCommitId,omitempty"`
+
+	// ValuesHash: hash of the effective template values that were rendered
+	ValuesHash string `json:"valuesHash,omitempty"`
+
+	// Added: number of files that would be added
+	Added int `json:"added"`
+
+	// Modified: number of files that would be modified, including the ones whose only change is the mode
+	Modified int `json:"modified"`
+
+	// Deleted: number of files that would be deleted
+	Deleted int `json:"deleted"`
+
+	// ModeChanged: number of files whose mode would change
+	ModeChanged int `json:"modeChanged"`
+
+	// Files: changed files, at most 100
+	// +optional
+	Files []DryRunFile `json:"files,omitempty"`
+
+	// DiffConfigMapRef: configmap holding the unified diff of the changes in the `diff` key
+	// +optional
+	DiffConfigMapRef *commonv1.Reference `json:"diffConfigMapRef,omitempty"`
+
+	// DiffTruncated: `true` if the unified diff was too large and has been truncated
+	// +optional
+	DiffTruncated bool `json:"diffTruncated,omitempty"`
+}
+
+// DryRunFile: a file that would be changed in the target repo.
+type DryRunFile struct {
+	// Path: path of the file in the target repo
+	Path string `json:"path"`
+
+	// Change: Possible values are: `Added`, `Modified`, `Deleted`
+	Change string `json:"change"`
+
+	// Mode: mode change of the file (e.g. `100644 -> 100755`), empty if the mode does not change
+	// +optional
+	Mode string `json:"mode,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -116,6 +427,11 @@ type RepoStatus struct {
 // +kubebuilder:printcolumn:name="TARGET_BRANCH",type="string",JSONPath=".status.targetBranch"
 // +kubebuilder:printcolumn:name="READY",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
 // +kubebuilder:printcolumn:name="SYNCED",type="string",JSONPath=".status.conditions[?(@.type=='Synced')].status"
+// +kubebuilder:printcolumn:name="LAST_SYNC",type="date",JSONPath=".status.lastSyncTime"
+// +kubebuilder:printcolumn:name="NEXT_SYNC",type="date",JSONPath=".status.nextSyncTime",priority=1
+// +kubebuilder:printcolumn:name="ADDED",type="integer",JSONPath=".status.lastCommit.added",priority=1
+// +kubebuilder:printcolumn:name="MODIFIED",type="integer",JSONPath=".status.lastCommit.modified",priority=1
+// +kubebuilder:printcolumn:name="DELETED",type="integer",JSONPath=".status.lastCommit.deleted",priority=1
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Namespaced,categories={git,krateo}
@@ -22,12 +22,92 @@ package v1alpha1
 
 import (
 	"github.com/krateoplatformops/provider-runtime/apis/common/v1"
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CommitStats) DeepCopyInto(out *CommitStats) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CommitStats.
+func (in *CommitStats) DeepCopy() *CommitStats {
+	if in == nil {
+		return nil
+	}
+	out := new(CommitStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DelimitersOpts) DeepCopyInto(out *DelimitersOpts) {
+	*out = *in
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DelimitersOpts.
+func (in *DelimitersOpts) DeepCopy() *DelimitersOpts {
+	if in == nil {
+		return nil
+	}
+	out := new(DelimitersOpts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DryRunFile) DeepCopyInto(out *DryRunFile) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DryRunFile.
+func (in *DryRunFile) DeepCopy() *DryRunFile {
+	if in == nil {
+		return nil
+	}
+	out := new(DryRunFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DryRunStatus) DeepCopyInto(out *DryRunStatus) {
+	*out = *in
+	if in.Files != nil {
+		in, out := &in.Files, &out.Files
+		*out = make([]DryRunFile, len(*in))
+		copy(*out, *in)
+	}
+	if in.DiffConfigMapRef != nil {
+		in, out := &in.DiffConfigMapRef, &out.DiffConfigMapRef
+		*out = new(v1.Reference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DryRunStatus.
+func (in *DryRunStatus) DeepCopy() *DryRunStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DryRunStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FromRepoOpts) DeepCopyInto(out *FromRepoOpts) {
 	*out = *in
+	if in.VerifySignatures != nil {
+		in, out := &in.VerifySignatures, &out.VerifySignatures
+		*out = new(VerifySignaturesOpts)
+		(*in).DeepCopyInto(*out)
+	}
 	in.RepoOpts.DeepCopyInto(&out.RepoOpts)
 }
 
@@ -41,6 +121,21 @@ func (in *FromRepoOpts) DeepCopy() *FromRepoOpts {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PathTemplatingOpts) DeepCopyInto(out *PathTemplatingOpts) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PathTemplatingOpts.
+func (in *PathTemplatingOpts) DeepCopy() *PathTemplatingOpts {
+	if in == nil {
+		return nil
+	}
+	out := new(PathTemplatingOpts)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Repo) DeepCopyInto(out *Repo) {
 	*out = *in
@@ -135,6 +230,40 @@ func (in *RepoSpec) DeepCopyInto(out *RepoSpec) {
 		*out = new(v1.ConfigMapKeySelector)
 		**out = **in
 	}
+	if in.ValuesFrom != nil {
+		in, out := &in.ValuesFrom, &out.ValuesFrom
+		*out = make([]ValuesSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Delimiters != nil {
+		in, out := &in.Delimiters, &out.Delimiters
+		*out = make([]DelimitersOpts, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PathTemplating != nil {
+		in, out := &in.PathTemplating, &out.PathTemplating
+		*out = new(PathTemplatingOpts)
+		**out = **in
+	}
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(ScheduleOpts)
+		**out = **in
+	}
+	if in.SyncWindows != nil {
+		in, out := &in.SyncWindows, &out.SyncWindows
+		*out = make([]SyncWindow, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RepoSpec.
@@ -151,6 +280,33 @@ func (in *RepoSpec) DeepCopy() *RepoSpec {
 func (in *RepoStatus) DeepCopyInto(out *RepoStatus) {
 	*out = *in
 	in.ConditionedStatus.DeepCopyInto(&out.ConditionedStatus)
+	if in.LastAttemptTime != nil {
+		in, out := &in.LastAttemptTime, &out.LastAttemptTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSyncTime != nil {
+		in, out := &in.LastSyncTime, &out.LastSyncTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextSyncTime != nil {
+		in, out := &in.NextSyncTime, &out.NextSyncTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastCommit != nil {
+		in, out := &in.LastCommit, &out.LastCommit
+		*out = new(CommitStats)
+		**out = **in
+	}
+	if in.Durations != nil {
+		in, out := &in.Durations, &out.Durations
+		*out = new(SyncDurations)
+		**out = **in
+	}
+	if in.DryRun != nil {
+		in, out := &in.DryRun, &out.DryRun
+		*out = new(DryRunStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RepoStatus.
@@ -162,3 +318,153 @@ func (in *RepoStatus) DeepCopy() *RepoStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScheduleOpts) DeepCopyInto(out *ScheduleOpts) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScheduleOpts.
+func (in *ScheduleOpts) DeepCopy() *ScheduleOpts {
+	if in == nil {
+		return nil
+	}
+	out := new(ScheduleOpts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SigningKeyOpts) DeepCopyInto(out *SigningKeyOpts) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.SecretKeySelector)
+		**out = **in
+	}
+	if in.PassphraseRef != nil {
+		in, out := &in.PassphraseRef, &out.PassphraseRef
+		*out = new(v1.SecretKeySelector)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SigningKeyOpts.
+func (in *SigningKeyOpts) DeepCopy() *SigningKeyOpts {
+	if in == nil {
+		return nil
+	}
+	out := new(SigningKeyOpts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SyncDurations) DeepCopyInto(out *SyncDurations) {
+	*out = *in
+	out.Clone = in.Clone
+	out.Render = in.Render
+	out.Push = in.Push
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SyncDurations.
+func (in *SyncDurations) DeepCopy() *SyncDurations {
+	if in == nil {
+		return nil
+	}
+	out := new(SyncDurations)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SyncWindow) DeepCopyInto(out *SyncWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SyncWindow.
+func (in *SyncWindow) DeepCopy() *SyncWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(SyncWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ToRepoOpts) DeepCopyInto(out *ToRepoOpts) {
+	*out = *in
+	if in.ProtectedPaths != nil {
+		in, out := &in.ProtectedPaths, &out.ProtectedPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SigningKey != nil {
+		in, out := &in.SigningKey, &out.SigningKey
+		*out = new(SigningKeyOpts)
+		(*in).DeepCopyInto(*out)
+	}
+	in.RepoOpts.DeepCopyInto(&out.RepoOpts)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ToRepoOpts.
+func (in *ToRepoOpts) DeepCopy() *ToRepoOpts {
+	if in == nil {
+		return nil
+	}
+	out := new(ToRepoOpts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValuesSource) DeepCopyInto(out *ValuesSource) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(v1.ConfigMapKeySelector)
+		**out = **in
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(v1.SecretKeySelector)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValuesSource.
+func (in *ValuesSource) DeepCopy() *ValuesSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ValuesSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VerifySignaturesOpts) DeepCopyInto(out *VerifySignaturesOpts) {
+	*out = *in
+	if in.KeyringConfigMapRef != nil {
+		in, out := &in.KeyringConfigMapRef, &out.KeyringConfigMapRef
+		*out = new(v1.ConfigMapKeySelector)
+		**out = **in
+	}
+	if in.KeyringSecretRef != nil {
+		in, out := &in.KeyringSecretRef, &out.KeyringSecretRef
+		*out = new(v1.SecretKeySelector)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VerifySignaturesOpts.
+func (in *VerifySignaturesOpts) DeepCopy() *VerifySignaturesOpts {
+	if in == nil {
+		return nil
+	}
+	out := new(VerifySignaturesOpts)
+	in.DeepCopyInto(out)
+	return out
+}
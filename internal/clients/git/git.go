@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	gitclient "github.com/go-git/go-git/v5/plumbing/transport/client"
 	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-git/go-git/v5/storage"
@@ -29,6 +30,7 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
 	"github.com/krateoplatformops/plumbing/ptr"
 )
 
@@ -42,6 +44,8 @@ var (
 	ErrEmptyRemoteRepository  = errors.New("remote repository is empty")
 	ErrAuthenticationRequired = errors.New("authentication required")
 	ErrAuthorizationFailed    = errors.New("authorization failed")
+	ErrNonFastForward         = errors.New("push rejected: remote branch contains commits not present locally")
+	ErrStaleLease             = errors.New("push rejected: remote branch does not point to the leased commit")
 	NoErrAlreadyUpToDate      = git.NoErrAlreadyUpToDate
 )
 
@@ -56,6 +60,8 @@ type Repo struct {
 	isNewBranch *bool
 	cookie      []byte
 	tmpDir      string
+	signer      Signer
+	orphanedTip plumbing.Hash
 }
 
 type CloneOptions struct {
@@ -67,6 +73,7 @@ type CloneOptions struct {
 	AlternativeBranch       *string
 	GitCookies              []byte
 	HomeDir                 string // The home directory to use for temporary files
+	Signer                  Signer // Optional signer used to sign commits
 }
 
 type ListOptions struct {
@@ -82,6 +89,9 @@ type IndexOptions struct {
 	OriginRepo *Repo
 	FromPath   string
 	ToPath     string
+	// Modes are the modes of the copied files by path in the repository (e.g. `charts/app/run.sh`), they take
+	// precedence over the modes of the origin files with the same relative path
+	Modes map[string]filemode.FileMode
 }
 
 func (repo *Repo) setDefaultHTTPSClient() {
@@ -283,7 +293,8 @@ func IsInGitCommitHistory(opts ListOptions, hash string) (bool, error) {
 }
 
 /*
-The function simulate the application of filemode of each from the origin repo (contained in "IndexOption.FromPath") to the destination repo (to files contained in IndexOption.ToPath)
+The function simulate the application of filemode of each from the origin repo (contained in "IndexOption.FromPath") to the destination repo (to files contained in IndexOption.ToPath).
+Files listed in "IndexOption.Modes" get their mode from there, so that files whose name has been rendered keep the mode of their origin file.
 ---- git update-index --chmod
 */
 func (s *Repo) UpdateIndex(idx *IndexOptions) error {
@@ -334,8 +345,11 @@ func (s *Repo) UpdateIndex(idx *IndexOptions) error {
 		if fromEntry != nil {
 			e.Mode = fromEntry.Mode
 		}
+		if mode, ok := idx.Modes[e.Name]; ok {
+			e.Mode = mode
+		}
 	}
-	return nil
+	return s.storer.SetIndex(toIdx)
 }
 func Clone(opts CloneOptions) (*Repo, error) {
 	tmpDir, err := os.MkdirTemp(opts.HomeDir, "git-provider-clone-*")
@@ -358,6 +372,7 @@ func Clone(opts CloneOptions) (*Repo, error) {
 		fs:     diskFS,
 		cookie: opts.GitCookies,
 		tmpDir: tmpDir,
+		signer: opts.Signer,
 	}
 
 	if len(res.cookie) > 0 {
@@ -476,6 +491,15 @@ func (s *Repo) CurrentBranch() string {
 	return head.Target().Short()
 }
 
+// HeadRef returns the full name of the reference checked out in the worktree, e.g. `refs/heads/main`.
+func (s *Repo) HeadRef() (string, error) {
+	head, err := s.repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	return head.Name().String(), nil
+}
+
 type CreateOpt struct {
 	Create bool
 	Orphan bool
@@ -560,7 +584,7 @@ func (s *Repo) Commit(path, msg string, opt *IndexOptions) (string, error) {
 	}
 
 	if fStatus.IsClean() && !ptr.Deref(s.isNewBranch, false) {
-		return "", NoErrAlreadyUpToDate
+		return "", s.restoreOrphanedTip()
 	}
 
 	// git commit -m $message
@@ -570,15 +594,104 @@ func (s *Repo) Commit(path, msg string, opt *IndexOptions) (string, error) {
 			Email: commitAuthorEmail,
 			When:  time.Now(),
 		},
+		Signer: s.signer,
 	})
 	if err != nil {
+		if s.signer != nil {
+			return "", fmt.Errorf("failed to create signed commit: %w", err)
+		}
 		return "", NoErrAlreadyUpToDate
 	}
 
+	// an orphan commit equal to the previous one (same content and no history) is not a change
+	if !s.orphanedTip.IsZero() {
+		prev, err := s.repo.CommitObject(s.orphanedTip)
+		if err == nil && prev.NumParents() == 0 {
+			curr, err := s.repo.CommitObject(hash)
+			if err != nil {
+				return "", err
+			}
+			if curr.TreeHash == prev.TreeHash {
+				return "", s.restoreOrphanedTip()
+			}
+		}
+	}
+
 	return hash.String(), nil
 }
 
-func (s *Repo) Push(downstream, branch string, insecure bool) error {
+/*
+Orphan detaches the current branch from its history and empties the worktree, the next commit will have no parents
+and will contain only the files added after the call - `git checkout --orphan tmp && git rm -rf . && git branch -M tmp branch`.
+The files for which keep returns true, if not nil, are left in the worktree and in the index.
+*/
+func (s *Repo) Orphan(keep func(path string) bool) error {
+	branch := s.CurrentBranch()
+	refName := plumbing.NewBranchReferenceName(branch)
+
+	if ref, err := s.repo.Reference(refName, true); err == nil {
+		s.orphanedTip = ref.Hash()
+		if err := s.repo.Storer.RemoveReference(refName); err != nil {
+			return err
+		}
+	}
+
+	if keep == nil {
+		return s.Branch(branch, &CreateOpt{
+			Create: true,
+			Orphan: true,
+		})
+	}
+
+	if err := s.repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, refName)); err != nil {
+		return err
+	}
+	wt, err := s.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	idx, err := s.repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+	for _, e := range idx.Entries {
+		if keep(e.Name) {
+			continue
+		}
+		if _, err := wt.Remove(e.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreOrphanedTip points the current branch back to the commit it had before Orphan was called.
+func (s *Repo) restoreOrphanedTip() error {
+	if s.orphanedTip.IsZero() {
+		return NoErrAlreadyUpToDate
+	}
+	ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName(s.CurrentBranch()), s.orphanedTip)
+	if err := s.repo.Storer.SetReference(ref); err != nil {
+		return err
+	}
+	return NoErrAlreadyUpToDate
+}
+
+type PushOpt struct {
+	Force bool
+	// WithLease, if set together with Force, rejects the push unless the remote branch still points to
+	// Lease or, if Lease is empty, to the commit fetched during clone.
+	WithLease bool
+	Lease     string
+}
+
+/*
+Push the branch to the remote according to parameters passed in pushOpt.
+  - if pushOpt is `nil` or pushOpt.Force is false only fast-forward updates are allowed - `git push`
+  - if pushOpt.Force is true the remote branch is overwritten - `git push --force`
+  - if both pushOpt.Force and pushOpt.WithLease are true the remote branch is overwritten only if it still points to the leased commit - `git push --force-with-lease`
+*/
+func (s *Repo) Push(downstream, branch string, insecure bool, pushOpt *PushOpt) error {
 	if err := s.setCustomHTTPSClientWithCookieJar(); err != nil {
 		return err
 	}
@@ -620,7 +733,7 @@ func (s *Repo) Push(downstream, branch string, insecure bool) error {
 		}
 	}
 
-	return s.repo.Push(&git.PushOptions{
+	opts := &git.PushOptions{
 		RemoteName:      downstream,
 		Force:           false,
 		Auth:            s.auth,
@@ -628,7 +741,101 @@ func (s *Repo) Push(downstream, branch string, insecure bool) error {
 		RefSpecs: []config.RefSpec{
 			config.RefSpec(refName + ":" + refName),
 		},
+	}
+
+	leased := false
+	if pushOpt != nil && pushOpt.Force {
+		if !pushOpt.WithLease {
+			opts.Force = true
+			opts.RefSpecs = []config.RefSpec{
+				config.RefSpec("+" + refName + ":" + refName),
+			}
+		} else if _, err := s.repo.Reference(plumbing.NewRemoteReferenceName(downstream, branch), true); err == nil {
+			// a zero Hash makes go-git use the remote-tracking branch as lease
+			leased = true
+			opts.ForceWithLease = &git.ForceWithLease{
+				RefName: refName,
+				Hash:    plumbing.NewHash(pushOpt.Lease),
+			}
+		} else if pushOpt.Lease != "" {
+			return fmt.Errorf("%w: branch %s was not found on remote %s", ErrStaleLease, branch, downstream)
+		}
+		// without a lease (branch not on remote when cloned) a plain push is performed:
+		// it only succeeds if nobody created the branch meanwhile.
+	}
+
+	err = s.repo.Push(opts)
+	if err != nil && isNonFastForward(err) {
+		if leased {
+			return fmt.Errorf("%w: %v", ErrStaleLease, err)
+		}
+		return fmt.Errorf("%w: %v", ErrNonFastForward, err)
+	}
+	return err
+}
+
+func isNonFastForward(err error) bool {
+	if errors.Is(err, git.ErrNonFastForwardUpdate) || errors.Is(err, git.ErrForceNeeded) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "non-fast-forward") || strings.Contains(msg, "fetch first")
+}
+
+/*
+ResetToRemote fetches the branch from the remote and moves the local branch, the index and the worktree to the fetched tip,
+discarding local commits and untracked files - `git fetch origin branch && git reset --hard origin/branch && git clean -fd`
+*/
+func (s *Repo) ResetToRemote(downstream, branch string, insecure bool) error {
+	if err := s.setCustomHTTPSClientWithCookieJar(); err != nil {
+		return err
+	}
+	defer s.setDefaultHTTPSClient()
+
+	refName := plumbing.NewBranchReferenceName(branch)
+	remoteRefName := plumbing.NewRemoteReferenceName(downstream, branch)
+
+	err := s.repo.Fetch(&git.FetchOptions{
+		RemoteName:      downstream,
+		Auth:            s.auth,
+		InsecureSkipTLS: insecure,
+		Force:           true,
+		RefSpecs: []config.RefSpec{
+			config.RefSpec("+" + refName + ":" + remoteRefName),
+		},
 	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch branch %s: %w", branch, err)
+	}
+
+	remoteRef, err := s.repo.Reference(remoteRefName, true)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", remoteRefName, err)
+	}
+
+	if err := s.repo.Storer.SetReference(plumbing.NewHashReference(refName, remoteRef.Hash())); err != nil {
+		return err
+	}
+	if err := s.repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, refName)); err != nil {
+		return err
+	}
+
+	wt, err := s.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := wt.Reset(&git.ResetOptions{
+		Commit: remoteRef.Hash(),
+		Mode:   git.HardReset,
+	}); err != nil {
+		return fmt.Errorf("failed to reset worktree: %w", err)
+	}
+	if err := wt.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("failed to clean worktree: %w", err)
+	}
+
+	s.isNewBranch = ptr.To(false)
+	return nil
 }
 
 func Pull(s *Repo, insecure bool) error {
@@ -658,6 +865,100 @@ func Pull(s *Repo, insecure bool) error {
 	return err
 }
 
+// FileChange is a file changed between two commits.
+type FileChange struct {
+	Path     string
+	Action   string
+	FromMode filemode.FileMode
+	ToMode   filemode.FileMode
+}
+
+const (
+	ChangeAdded    = "Added"
+	ChangeModified = "Modified"
+	ChangeDeleted  = "Deleted"
+)
+
+// Changes returns the files changed between the commits from and to. An empty from is the empty tree.
+func (s *Repo) Changes(from, to string) ([]FileChange, error) {
+	changes, err := s.diffTree(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return fileChanges(changes)
+}
+
+// Diff returns the files changed between the commits from and to, and their unified diff. An empty from is the empty tree.
+func (s *Repo) Diff(from, to string) ([]FileChange, string, error) {
+	changes, err := s.diffTree(from, to)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := fileChanges(changes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	patch, err := changes.Patch()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to compute patch: %w", err)
+	}
+	return res, patch.String(), nil
+}
+
+func (s *Repo) diffTree(from, to string) (object.Changes, error) {
+	tree := func(hash string) (*object.Tree, error) {
+		if hash == "" {
+			return &object.Tree{}, nil
+		}
+		commit, err := s.repo.CommitObject(plumbing.NewHash(hash))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get commit %s: %w", hash, err)
+		}
+		return commit.Tree()
+	}
+
+	fromTree, err := tree(from)
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := tree(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff trees: %w", err)
+	}
+	return changes, nil
+}
+
+func fileChanges(changes object.Changes) ([]FileChange, error) {
+	res := make([]FileChange, 0, len(changes))
+	for _, ch := range changes {
+		action, err := ch.Action()
+		if err != nil {
+			return nil, err
+		}
+		fc := FileChange{
+			Path:     ch.To.Name,
+			FromMode: ch.From.TreeEntry.Mode,
+			ToMode:   ch.To.TreeEntry.Mode,
+		}
+		switch action {
+		case merkletrie.Insert:
+			fc.Action = ChangeAdded
+		case merkletrie.Delete:
+			fc.Action, fc.Path = ChangeDeleted, ch.From.Name
+		default:
+			fc.Action = ChangeModified
+		}
+		res = append(res, fc)
+	}
+	return res, nil
+}
+
 func (s *Repo) GetLatestCommit(branch string) (string, error) {
 	if err := s.setCustomHTTPSClientWithCookieJar(); err != nil {
 		return "", err
@@ -670,3 +971,40 @@ func (s *Repo) GetLatestCommit(branch string) (string, error) {
 	}
 	return ref.Hash().String(), nil
 }
+
+// Checkout moves the worktree and the current branch to the given commit, discarding any local change.
+func (s *Repo) Checkout(hash string) error {
+	wt, err := s.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	if err := wt.Reset(&git.ResetOptions{Commit: plumbing.NewHash(hash), Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("failed to checkout commit %s: %w", hash, err)
+	}
+	return nil
+}
+
+// TreeHash returns the hash of the tree at path in the given commit, or an empty string if path does not exist.
+func (s *Repo) TreeHash(commitId, path string) (string, error) {
+	commit, err := s.repo.CommitObject(plumbing.NewHash(commitId))
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit %s: %w", commitId, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get tree of commit %s: %w", commitId, err)
+	}
+
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return tree.Hash.String(), nil
+	}
+	entry, err := tree.FindEntry(path)
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return entry.Hash.String(), nil
+}
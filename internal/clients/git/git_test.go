@@ -1,11 +1,23 @@
 package git
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestIsInGitCommitHistory(t *testing.T) {
@@ -113,6 +125,22 @@ func TestCurrentBranch(t *testing.T) {
 	assert.Equal(t, "master", branch)
 }
 
+func TestHeadRef(t *testing.T) {
+	baseRepo := BaseSuite{}
+	baseRepo.BuildBasicRepository()
+
+	repo, err := Clone(CloneOptions{
+		URL:    baseRepo.GetBasicLocalRepositoryURL(),
+		Branch: "master",
+	})
+	require.NoError(t, err)
+	defer repo.Cleanup()
+
+	ref, err := repo.HeadRef()
+	require.NoError(t, err)
+	assert.Equal(t, "refs/heads/master", ref)
+}
+
 func TestGetLatestCommit(t *testing.T) {
 	baseRepo := BaseSuite{}
 	baseRepo.BuildBasicRepository()
@@ -155,7 +183,7 @@ func TestPush(t *testing.T) {
 		require.NoError(t, err)
 
 		// Push to a different branch to avoid the "currently checked out" error
-		err = repo.Push("origin", "test-branch", false)
+		err = repo.Push("origin", "test-branch", false, nil)
 		require.NoError(t, err)
 	})
 
@@ -189,7 +217,7 @@ func TestPush(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		err = repo.Push("origin", "feature", false)
+		err = repo.Push("origin", "feature", false, nil)
 		require.NoError(t, err)
 	})
 
@@ -217,7 +245,7 @@ func TestPush(t *testing.T) {
 		require.NoError(t, err)
 
 		// Push to a different branch to avoid the "currently checked out" error
-		err = repo.Push("origin", "insecure-test-branch", true)
+		err = repo.Push("origin", "insecure-test-branch", true, nil)
 		require.NoError(t, err)
 	})
 
@@ -245,7 +273,481 @@ func TestPush(t *testing.T) {
 		require.NoError(t, err)
 
 		// Try to push to a branch that doesn't exist locally yet
-		err = repo.Push("origin", "new-branch", false)
+		err = repo.Push("origin", "new-branch", false, nil)
+		require.NoError(t, err)
+	})
+}
+
+func TestCommitSigned(t *testing.T) {
+	baseRepo := BaseSuite{}
+	baseRepo.BuildBasicRepository()
+
+	commitFile := func(t *testing.T, signer Signer) *object.Commit {
+		repo, err := Clone(CloneOptions{
+			URL:    baseRepo.GetBasicLocalRepositoryURL(),
+			Branch: "master",
+			Signer: signer,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { repo.Cleanup() })
+
+		file, err := repo.FS().OpenFile("signed.txt", os.O_RDWR|os.O_CREATE, 0644)
+		require.NoError(t, err)
+		_, err = file.Write([]byte("signed content"))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		hash, err := repo.Commit("signed.txt", "Add signed file", &IndexOptions{
+			OriginRepo: repo,
+			FromPath:   "/",
+			ToPath:     "/",
+		})
+		require.NoError(t, err)
+
+		commit, err := repo.repo.CommitObject(plumbing.NewHash(hash))
+		require.NoError(t, err)
+		require.NotEmpty(t, commit.PGPSignature)
+		return commit
+	}
+
+	t.Run("openpgp", func(t *testing.T) {
+		entity, err := openpgp.NewEntity("krateoctl", "", commitAuthorEmail, nil)
+		require.NoError(t, err)
+
+		var priv, pub bytes.Buffer
+		w, err := armor.Encode(&priv, openpgp.PrivateKeyType, nil)
+		require.NoError(t, err)
+		require.NoError(t, entity.SerializePrivate(w, nil))
+		require.NoError(t, w.Close())
+		w, err = armor.Encode(&pub, openpgp.PublicKeyType, nil)
+		require.NoError(t, err)
+		require.NoError(t, entity.Serialize(w))
+		require.NoError(t, w.Close())
+
+		signer, err := NewOpenPGPSigner(priv.Bytes(), nil)
+		require.NoError(t, err)
+
+		commit := commitFile(t, signer)
+		signedBy, err := commit.Verify(pub.String())
+		require.NoError(t, err)
+		assert.Equal(t, entity.PrimaryKey.KeyId, signedBy.PrimaryKey.KeyId)
+	})
+
+	t.Run("ssh", func(t *testing.T) {
+		pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		block, err := ssh.MarshalPrivateKey(privKey, "")
+		require.NoError(t, err)
+
+		signer, err := NewSSHSigner(pem.EncodeToMemory(block), nil)
+		require.NoError(t, err)
+
+		commit := commitFile(t, signer)
+
+		encoded := &plumbing.MemoryObject{}
+		require.NoError(t, commit.EncodeWithoutSignature(encoded))
+		r, err := encoded.Reader()
+		require.NoError(t, err)
+
+		signedBy, err := VerifySSHSignature(commit.PGPSignature, r)
+		require.NoError(t, err)
+		expected, err := ssh.NewPublicKey(pubKey)
+		require.NoError(t, err)
+		assert.Equal(t, expected.Marshal(), signedBy.Marshal())
+	})
+
+	t.Run("locked openpgp key", func(t *testing.T) {
+		entity, err := openpgp.NewEntity("krateoctl", "", commitAuthorEmail, nil)
+		require.NoError(t, err)
+		require.NoError(t, entity.EncryptPrivateKeys([]byte("secret"), nil))
+
+		var priv bytes.Buffer
+		w, err := armor.Encode(&priv, openpgp.PrivateKeyType, nil)
 		require.NoError(t, err)
+		require.NoError(t, entity.SerializePrivateWithoutSigning(w, nil))
+		require.NoError(t, w.Close())
+
+		_, err = NewOpenPGPSigner(priv.Bytes(), nil)
+		assert.ErrorIs(t, err, ErrSigningKeyLocked)
+
+		_, err = NewOpenPGPSigner(priv.Bytes(), []byte("wrong"))
+		assert.ErrorIs(t, err, ErrSigningKeyLocked)
+
+		_, err = NewOpenPGPSigner(priv.Bytes(), []byte("secret"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("locked ssh key", func(t *testing.T) {
+		_, privKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		block, err := ssh.MarshalPrivateKeyWithPassphrase(privKey, "", []byte("secret"))
+		require.NoError(t, err)
+
+		_, err = NewSSHSigner(pem.EncodeToMemory(block), nil)
+		assert.ErrorIs(t, err, ErrSigningKeyLocked)
+
+		_, err = NewSSHSigner(pem.EncodeToMemory(block), []byte("secret"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := NewOpenPGPSigner([]byte("not a key"), nil)
+		assert.ErrorIs(t, err, ErrSigningKeyInvalid)
+
+		_, err = NewSSHSigner([]byte("not a key"), nil)
+		assert.ErrorIs(t, err, ErrSigningKeyInvalid)
 	})
 }
+
+func TestPushNonFastForward(t *testing.T) {
+	baseRepo := BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	writeAndCommit := func(t *testing.T, repo *Repo, name string) {
+		file, err := repo.FS().OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+		require.NoError(t, err)
+		_, err = file.Write([]byte(name))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		_, err = repo.Commit(name, "Add "+name, &IndexOptions{
+			OriginRepo: repo,
+			FromPath:   "/",
+			ToPath:     "/",
+		})
+		require.NoError(t, err)
+	}
+
+	first, err := Clone(CloneOptions{URL: url, Branch: "master"})
+	require.NoError(t, err)
+	defer first.Cleanup()
+	second, err := Clone(CloneOptions{URL: url, Branch: "master"})
+	require.NoError(t, err)
+	defer second.Cleanup()
+
+	writeAndCommit(t, first, "first.txt")
+	require.NoError(t, first.Push("origin", "race", false, nil))
+
+	writeAndCommit(t, second, "second.txt")
+	err = second.Push("origin", "race", false, nil)
+	require.ErrorIs(t, err, ErrNonFastForward)
+
+	require.NoError(t, second.ResetToRemote("origin", "race", false))
+	assert.Equal(t, "race", second.CurrentBranch())
+
+	exists, err := second.Exists("first.txt")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = second.Exists("second.txt")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	writeAndCommit(t, second, "second.txt")
+	require.NoError(t, second.Push("origin", "race", false, nil))
+
+	remoteTip, err := GetLatestCommitRemote(ListOptions{URL: url, Branch: "race"})
+	require.NoError(t, err)
+	localTip, err := second.GetLatestCommit("race")
+	require.NoError(t, err)
+	assert.Equal(t, localTip, *remoteTip)
+}
+
+func TestPushForce(t *testing.T) {
+	baseRepo := BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	writeAndCommit := func(t *testing.T, repo *Repo, name string) string {
+		file, err := repo.FS().OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+		require.NoError(t, err)
+		_, err = file.Write([]byte(name))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		hash, err := repo.Commit(name, "Add "+name, &IndexOptions{
+			OriginRepo: repo,
+			FromPath:   "/",
+			ToPath:     "/",
+		})
+		require.NoError(t, err)
+		return hash
+	}
+
+	remoteTip := func(t *testing.T) string {
+		tip, err := GetLatestCommitRemote(ListOptions{URL: url, Branch: "rendered"})
+		require.NoError(t, err)
+		return *tip
+	}
+
+	first, err := Clone(CloneOptions{URL: url, Branch: "master"})
+	require.NoError(t, err)
+	defer first.Cleanup()
+	leased := writeAndCommit(t, first, "first.txt")
+	require.NoError(t, first.Push("origin", "rendered", false, nil))
+
+	t.Run("force", func(t *testing.T) {
+		repo, err := Clone(CloneOptions{URL: url, Branch: "master"})
+		require.NoError(t, err)
+		defer repo.Cleanup()
+
+		hash := writeAndCommit(t, repo, "forced.txt")
+		err = repo.Push("origin", "rendered", false, nil)
+		require.ErrorIs(t, err, ErrNonFastForward)
+
+		require.NoError(t, repo.Push("origin", "rendered", false, &PushOpt{Force: true}))
+		assert.Equal(t, hash, remoteTip(t))
+		leased = hash
+	})
+
+	t.Run("force with lease", func(t *testing.T) {
+		repo, err := Clone(CloneOptions{URL: url, Branch: "rendered"})
+		require.NoError(t, err)
+		defer repo.Cleanup()
+		hash := writeAndCommit(t, repo, "leased.txt")
+
+		other, err := Clone(CloneOptions{URL: url, Branch: "rendered"})
+		require.NoError(t, err)
+		defer other.Cleanup()
+		unexpected := writeAndCommit(t, other, "unexpected.txt")
+		require.NoError(t, other.Push("origin", "rendered", false, nil))
+
+		err = repo.Push("origin", "rendered", false, &PushOpt{Force: true, WithLease: true, Lease: leased})
+		require.ErrorIs(t, err, ErrStaleLease)
+		assert.Equal(t, unexpected, remoteTip(t))
+
+		require.NoError(t, repo.Push("origin", "rendered", false, &PushOpt{Force: true, WithLease: true, Lease: unexpected}))
+		assert.Equal(t, hash, remoteTip(t))
+	})
+}
+
+func TestOrphan(t *testing.T) {
+	baseRepo := BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	writeAndCommit := func(t *testing.T, repo *Repo, name, content string) (string, error) {
+		file, err := repo.FS().OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		require.NoError(t, err)
+		_, err = file.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		return repo.Commit(".", "Squashed render", &IndexOptions{
+			OriginRepo: repo,
+			FromPath:   "/",
+			ToPath:     "/",
+		})
+	}
+
+	repo, err := Clone(CloneOptions{URL: url, Branch: "master"})
+	require.NoError(t, err)
+	defer repo.Cleanup()
+
+	require.NoError(t, repo.Orphan(nil))
+	squashed, err := writeAndCommit(t, repo, "rendered.txt", "v1")
+	require.NoError(t, err)
+
+	commit, err := repo.repo.CommitObject(plumbing.NewHash(squashed))
+	require.NoError(t, err)
+	assert.Equal(t, 0, commit.NumParents())
+	tree, err := commit.Tree()
+	require.NoError(t, err)
+	require.Len(t, tree.Entries, 1)
+	assert.Equal(t, "rendered.txt", tree.Entries[0].Name)
+
+	require.NoError(t, repo.Push("origin", "rendered", false, &PushOpt{Force: true, WithLease: true}))
+
+	t.Run("unchanged render", func(t *testing.T) {
+		repo, err := Clone(CloneOptions{URL: url, Branch: "rendered"})
+		require.NoError(t, err)
+		defer repo.Cleanup()
+
+		require.NoError(t, repo.Orphan(nil))
+		_, err = writeAndCommit(t, repo, "rendered.txt", "v1")
+		require.ErrorIs(t, err, NoErrAlreadyUpToDate)
+
+		tip, err := repo.GetLatestCommit("rendered")
+		require.NoError(t, err)
+		assert.Equal(t, squashed, tip)
+	})
+
+	t.Run("changed render", func(t *testing.T) {
+		repo, err := Clone(CloneOptions{URL: url, Branch: "rendered"})
+		require.NoError(t, err)
+		defer repo.Cleanup()
+
+		require.NoError(t, repo.Orphan(nil))
+		hash, err := writeAndCommit(t, repo, "rendered.txt", "v2")
+		require.NoError(t, err)
+
+		commit, err := repo.repo.CommitObject(plumbing.NewHash(hash))
+		require.NoError(t, err)
+		assert.Equal(t, 0, commit.NumParents())
+
+		require.NoError(t, repo.Push("origin", "rendered", false, &PushOpt{Force: true, WithLease: true, Lease: squashed}))
+		tip, err := GetLatestCommitRemote(ListOptions{URL: url, Branch: "rendered"})
+		require.NoError(t, err)
+		assert.Equal(t, hash, *tip)
+	})
+
+	t.Run("keep", func(t *testing.T) {
+		repo, err := Clone(CloneOptions{URL: url, Branch: "master"})
+		require.NoError(t, err)
+		defer repo.Cleanup()
+
+		require.NoError(t, repo.Orphan(func(path string) bool { return strings.HasPrefix(path, "json/") }))
+		hash, err := writeAndCommit(t, repo, "rendered.txt", "v1")
+		require.NoError(t, err)
+
+		commit, err := repo.repo.CommitObject(plumbing.NewHash(hash))
+		require.NoError(t, err)
+		assert.Equal(t, 0, commit.NumParents())
+		tree, err := commit.Tree()
+		require.NoError(t, err)
+		var names []string
+		for _, e := range tree.Entries {
+			names = append(names, e.Name)
+		}
+		assert.ElementsMatch(t, []string{"json", "rendered.txt"}, names)
+		_, err = repo.FS().Stat("/json/short.json")
+		assert.NoError(t, err)
+		_, err = repo.FS().Stat("/CHANGELOG")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestUpdateIndexModes(t *testing.T) {
+	baseRepo := BaseSuite{}
+	baseRepo.BuildBasicRepository()
+
+	repo, err := Clone(CloneOptions{URL: baseRepo.GetBasicLocalRepositoryURL(), Branch: "master"})
+	require.NoError(t, err)
+	defer repo.Cleanup()
+
+	for _, name := range []string{"bin/run.sh", "bin/README.md"} {
+		require.NoError(t, repo.FS().MkdirAll("bin", 0755))
+		file, err := repo.FS().OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		require.NoError(t, err)
+		_, err = file.Write([]byte(name))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+	}
+
+	hash, err := repo.Commit(".", "Add scripts", &IndexOptions{
+		OriginRepo: repo,
+		FromPath:   "/",
+		ToPath:     "/",
+		Modes:      map[string]filemode.FileMode{"bin/run.sh": filemode.Executable},
+	})
+	require.NoError(t, err)
+
+	commit, err := repo.repo.CommitObject(plumbing.NewHash(hash))
+	require.NoError(t, err)
+	tree, err := commit.Tree()
+	require.NoError(t, err)
+
+	entry, err := tree.FindEntry("bin/run.sh")
+	require.NoError(t, err)
+	assert.Equal(t, filemode.Executable, entry.Mode)
+	entry, err = tree.FindEntry("bin/README.md")
+	require.NoError(t, err)
+	assert.Equal(t, filemode.Regular, entry.Mode)
+}
+
+func TestDiff(t *testing.T) {
+	baseRepo := BaseSuite{}
+	baseRepo.BuildBasicRepository()
+
+	repo, err := Clone(CloneOptions{URL: baseRepo.GetBasicLocalRepositoryURL(), Branch: "master"})
+	require.NoError(t, err)
+	defer repo.Cleanup()
+
+	from, err := repo.GetLatestCommit("master")
+	require.NoError(t, err)
+
+	for name, content := range map[string]string{"CHANGELOG": "changed\n", "new.txt": "new\n"} {
+		file, err := repo.FS().OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		require.NoError(t, err)
+		_, err = file.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+	}
+	require.NoError(t, repo.FS().Remove("LICENSE"))
+
+	to, err := repo.Commit(".", "Change files", &IndexOptions{
+		OriginRepo: repo,
+		FromPath:   "/",
+		ToPath:     "/",
+		Modes:      map[string]filemode.FileMode{"go/example.go": filemode.Executable},
+	})
+	require.NoError(t, err)
+
+	changes, patch, err := repo.Diff(from, to)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []FileChange{
+		{Path: "CHANGELOG", Action: ChangeModified, FromMode: filemode.Regular, ToMode: filemode.Regular},
+		{Path: "LICENSE", Action: ChangeDeleted, FromMode: filemode.Regular},
+		{Path: "go/example.go", Action: ChangeModified, FromMode: filemode.Regular, ToMode: filemode.Executable},
+		{Path: "new.txt", Action: ChangeAdded, ToMode: filemode.Regular},
+	}, changes)
+	assert.Contains(t, patch, "diff --git a/new.txt b/new.txt")
+	assert.Contains(t, patch, "+changed")
+	assert.Contains(t, patch, "old mode 100644\nnew mode 100755")
+
+	withoutPatch, err := repo.Changes(from, to)
+	require.NoError(t, err)
+	assert.Equal(t, changes, withoutPatch)
+
+	changes, _, err = repo.Diff("", from)
+	require.NoError(t, err)
+	for _, ch := range changes {
+		assert.Equal(t, ChangeAdded, ch.Action, ch.Path)
+	}
+	assert.NotEmpty(t, changes)
+}
+
+func TestCheckoutAndTreeHash(t *testing.T) {
+	baseRepo := BaseSuite{}
+	baseRepo.BuildBasicRepository()
+
+	repo, err := Clone(CloneOptions{URL: baseRepo.GetBasicLocalRepositoryURL(), Branch: "master"})
+	require.NoError(t, err)
+	defer repo.Cleanup()
+
+	first, err := repo.GetLatestCommit("master")
+	require.NoError(t, err)
+	goTree, err := repo.TreeHash(first, "/go/")
+	require.NoError(t, err)
+	assert.NotEmpty(t, goTree)
+
+	file, err := repo.FS().OpenFile("CHANGELOG", os.O_RDWR|os.O_TRUNC, 0644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("changed\n"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	second, err := repo.Commit(".", "Change CHANGELOG", &IndexOptions{OriginRepo: repo, FromPath: "/", ToPath: "/"})
+	require.NoError(t, err)
+
+	root1, err := repo.TreeHash(first, "")
+	require.NoError(t, err)
+	root2, err := repo.TreeHash(second, "/")
+	require.NoError(t, err)
+	assert.NotEqual(t, root1, root2)
+
+	hash, err := repo.TreeHash(second, "go")
+	require.NoError(t, err)
+	assert.Equal(t, goTree, hash, "unchanged directory")
+
+	hash, err = repo.TreeHash(second, "missing/dir")
+	require.NoError(t, err)
+	assert.Empty(t, hash)
+
+	require.NoError(t, repo.Checkout(first))
+	data, err := util.ReadFile(repo.FS(), "CHANGELOG")
+	require.NoError(t, err)
+	assert.NotEqual(t, "changed\n", string(data))
+	latest, err := repo.GetLatestCommit("master")
+	require.NoError(t, err)
+	assert.Equal(t, first, latest)
+}
@@ -0,0 +1,252 @@
+package git
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshSigMagic     = "SSHSIG"
+	sshSigVersion   = 1
+	sshSigNamespace = "git"
+	sshSigArmorHead = "-----BEGIN SSH SIGNATURE-----"
+	sshSigArmorTail = "-----END SSH SIGNATURE-----"
+)
+
+var (
+	ErrSigningKeyLocked  = errors.New("signing key is locked: a passphrase is required")
+	ErrSigningKeyInvalid = errors.New("signing key is invalid")
+)
+
+// Signer signs the encoded commit objects produced by Repo.Commit.
+type Signer = git.Signer
+
+type openPGPSigner struct {
+	entity *openpgp.Entity
+}
+
+// NewOpenPGPSigner returns a Signer producing armored detached OpenPGP
+// signatures. If the private key is encrypted the passphrase is used to
+// decrypt it.
+func NewOpenPGPSigner(armoredKey, passphrase []byte) (Signer, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armoredKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSigningKeyInvalid, err)
+	}
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("%w: no key found", ErrSigningKeyInvalid)
+	}
+
+	entity := entities[0]
+	if entity.PrivateKey == nil {
+		return nil, fmt.Errorf("%w: not a private key", ErrSigningKeyInvalid)
+	}
+
+	if entity.PrivateKey.Encrypted {
+		if len(passphrase) == 0 {
+			return nil, ErrSigningKeyLocked
+		}
+		if err := entity.DecryptPrivateKeys(passphrase); err != nil {
+			return nil, fmt.Errorf("%w: unable to decrypt with the supplied passphrase: %v", ErrSigningKeyLocked, err)
+		}
+	}
+
+	return &openPGPSigner{entity: entity}, nil
+}
+
+func (s *openPGPSigner) Sign(message io.Reader) ([]byte, error) {
+	var b bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&b, s.entity, message, nil); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+// NewSSHSigner returns a Signer producing signatures in the SSHSIG format
+// used by git when 'gpg.format' is 'ssh'. If the private key is encrypted
+// the passphrase is used to decrypt it.
+func NewSSHSigner(pemKey, passphrase []byte) (Signer, error) {
+	var (
+		signer ssh.Signer
+		err    error
+	)
+	if len(passphrase) > 0 {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pemKey, passphrase)
+	} else {
+		signer, err = ssh.ParsePrivateKey(pemKey)
+	}
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return nil, ErrSigningKeyLocked
+		}
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, fmt.Errorf("%w: unable to decrypt with the supplied passphrase", ErrSigningKeyLocked)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrSigningKeyInvalid, err)
+	}
+
+	return &sshSigner{signer: signer}, nil
+}
+
+func (s *sshSigner) Sign(message io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, err
+	}
+
+	signed := sshSignedData(sshSigNamespace, "sha512", h.Sum(nil))
+
+	var (
+		sig *ssh.Signature
+		err error
+	)
+	if as, ok := s.signer.(ssh.AlgorithmSigner); ok && s.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = as.SignWithAlgorithm(rand.Reader, signed, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = s.signer.Sign(rand.Reader, signed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	blob := struct {
+		Magic     [6]byte
+		Version   uint32
+		PublicKey []byte
+		Namespace string
+		Reserved  string
+		HashAlgo  string
+		Signature []byte
+	}{
+		Version:   sshSigVersion,
+		PublicKey: s.signer.PublicKey().Marshal(),
+		Namespace: sshSigNamespace,
+		HashAlgo:  "sha512",
+		Signature: ssh.Marshal(sig),
+	}
+	copy(blob.Magic[:], sshSigMagic)
+
+	return armorSSHSignature(ssh.Marshal(blob)), nil
+}
+
+// VerifySSHSignature checks an armored SSHSIG signature over message and
+// returns the public key that produced it.
+func VerifySSHSignature(armored string, message io.Reader) (ssh.PublicKey, error) {
+	raw, err := dearmorSSHSignature(armored)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) < len(sshSigMagic) || string(raw[:len(sshSigMagic)]) != sshSigMagic {
+		return nil, errors.New("invalid ssh signature: bad magic preamble")
+	}
+
+	var blob struct {
+		Version   uint32
+		PublicKey []byte
+		Namespace string
+		Reserved  string
+		HashAlgo  string
+		Signature []byte
+	}
+	if err := ssh.Unmarshal(raw[len(sshSigMagic):], &blob); err != nil {
+		return nil, fmt.Errorf("invalid ssh signature: %w", err)
+	}
+	if blob.Version != sshSigVersion {
+		return nil, fmt.Errorf("unsupported ssh signature version %d", blob.Version)
+	}
+	if blob.Namespace != sshSigNamespace {
+		return nil, fmt.Errorf("unexpected ssh signature namespace %q", blob.Namespace)
+	}
+
+	pub, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh signature public key: %w", err)
+	}
+
+	var h hash.Hash
+	switch blob.HashAlgo {
+	case "sha512":
+		h = sha512.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return nil, fmt.Errorf("unsupported ssh signature hash algorithm %q", blob.HashAlgo)
+	}
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, err
+	}
+
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(blob.Signature, sig); err != nil {
+		return nil, fmt.Errorf("invalid ssh signature: %w", err)
+	}
+
+	if err := pub.Verify(sshSignedData(blob.Namespace, blob.HashAlgo, h.Sum(nil)), sig); err != nil {
+		return nil, err
+	}
+
+	return pub, nil
+}
+
+func sshSignedData(namespace, hashAlgo string, digest []byte) []byte {
+	data := struct {
+		Magic     [6]byte
+		Namespace string
+		Reserved  string
+		HashAlgo  string
+		Hash      []byte
+	}{
+		Namespace: namespace,
+		HashAlgo:  hashAlgo,
+		Hash:      digest,
+	}
+	copy(data.Magic[:], sshSigMagic)
+	return ssh.Marshal(data)
+}
+
+func armorSSHSignature(raw []byte) []byte {
+	enc := base64.StdEncoding.EncodeToString(raw)
+
+	var b bytes.Buffer
+	b.WriteString(sshSigArmorHead)
+	b.WriteByte('\n')
+	for len(enc) > 70 {
+		b.WriteString(enc[:70])
+		b.WriteByte('\n')
+		enc = enc[70:]
+	}
+	b.WriteString(enc)
+	b.WriteByte('\n')
+	b.WriteString(sshSigArmorTail)
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+func dearmorSSHSignature(armored string) ([]byte, error) {
+	armored = strings.TrimSpace(armored)
+	if !strings.HasPrefix(armored, sshSigArmorHead) || !strings.HasSuffix(armored, sshSigArmorTail) {
+		return nil, errors.New("invalid ssh signature: missing armor")
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(armored, sshSigArmorHead), sshSigArmorTail)
+	body = strings.Join(strings.Fields(body), "")
+	return base64.StdEncoding.DecodeString(body)
+}
@@ -0,0 +1,226 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	pgpPublicKeyBlockHead = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+	pgpPublicKeyBlockTail = "-----END PGP PUBLIC KEY BLOCK-----"
+)
+
+var (
+	ErrCommitNotSigned       = errors.New("commit is not signed")
+	ErrCommitNotTrusted      = errors.New("commit is not signed by a trusted key")
+	ErrEmptyTrustedKeyring   = errors.New("trusted keyring contains no keys")
+	ErrInvalidTrustedKeyring = errors.New("trusted keyring is invalid")
+)
+
+// Keyring holds the OpenPGP and SSH public keys trusted to sign commits.
+type Keyring struct {
+	pgp openpgp.EntityList
+	ssh []ssh.PublicKey
+}
+
+/*
+NewKeyring parses the supplied data into a Keyring. Data may contain any number of:
+  - armored OpenPGP public key blocks
+  - SSH public keys, one per line, in the `authorized_keys` or `allowed_signers` format
+*/
+func NewKeyring(data string) (*Keyring, error) {
+	kr := &Keyring{}
+
+	var rest strings.Builder
+	for {
+		start := strings.Index(data, pgpPublicKeyBlockHead)
+		if start < 0 {
+			rest.WriteString(data)
+			break
+		}
+		rest.WriteString(data[:start])
+		data = data[start:]
+
+		end := strings.Index(data, pgpPublicKeyBlockTail)
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unterminated OpenPGP public key block", ErrInvalidTrustedKeyring)
+		}
+		end += len(pgpPublicKeyBlockTail)
+
+		el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(data[:end]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTrustedKeyring, err)
+		}
+		kr.pgp = append(kr.pgp, el...)
+		data = data[end:]
+	}
+
+	sc := bufio.NewScanner(strings.NewReader(rest.String()))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			// allowed_signers lines are prefixed by the principals
+			if _, after, found := strings.Cut(line, " "); found {
+				pub, _, _, _, err = ssh.ParseAuthorizedKey([]byte(after))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to parse line %q: %v", ErrInvalidTrustedKeyring, line, err)
+		}
+		kr.ssh = append(kr.ssh, pub)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(kr.pgp) == 0 && len(kr.ssh) == 0 {
+		return nil, ErrEmptyTrustedKeyring
+	}
+
+	return kr, nil
+}
+
+// Verify checks that the commit carries a valid signature made by one of the
+// trusted keys.
+func (kr *Keyring) Verify(c *object.Commit) error {
+	if strings.TrimSpace(c.PGPSignature) == "" {
+		return ErrCommitNotSigned
+	}
+
+	encoded := &plumbing.MemoryObject{}
+	if err := c.EncodeWithoutSignature(encoded); err != nil {
+		return err
+	}
+	msg, err := encoded.Reader()
+	if err != nil {
+		return err
+	}
+
+	if isSSHSignature(c.PGPSignature) {
+		pub, err := VerifySSHSignature(c.PGPSignature, msg)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrCommitNotTrusted, err)
+		}
+		for _, trusted := range kr.ssh {
+			if string(trusted.Marshal()) == string(pub.Marshal()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: ssh key %s", ErrCommitNotTrusted, ssh.FingerprintSHA256(pub))
+	}
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(kr.pgp, msg, strings.NewReader(c.PGPSignature), nil); err != nil {
+		return fmt.Errorf("%w: %v", ErrCommitNotTrusted, err)
+	}
+	return nil
+}
+
+// InHistory reports whether the commit is reachable from the tip of the
+// current branch. It returns false when the commit is unknown, for example
+// after the history has been rewritten by a force-push.
+func (s *Repo) InHistory(hash string) (bool, error) {
+	head, err := s.repo.Head()
+	if err != nil {
+		return false, fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	c, err := s.repo.CommitObject(plumbing.NewHash(hash))
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if c.Hash == head.Hash() {
+		return true, nil
+	}
+
+	tip, err := s.repo.CommitObject(head.Hash())
+	if err != nil {
+		return false, err
+	}
+	return c.IsAncestor(tip)
+}
+
+/*
+VerifyCommits checks the signatures of the commits of the current branch against the keyring.
+  - if `since` is empty only the tip commit is verified
+  - if `since` is not in the history of the current branch (see InHistory) only the tip commit is verified
+  - otherwise every commit reachable from the tip and not reachable from `since` is verified
+*/
+func (s *Repo) VerifyCommits(kr *Keyring, since string) error {
+	head, err := s.repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	if since != "" {
+		ok, err := s.InHistory(since)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			since = ""
+		}
+	}
+
+	if since == "" {
+		c, err := s.repo.CommitObject(head.Hash())
+		if err != nil {
+			return err
+		}
+		if err := kr.Verify(c); err != nil {
+			return fmt.Errorf("commit %s: %w", c.Hash, err)
+		}
+		return nil
+	}
+
+	// commits already synchronized (ancestors of `since` included) are not verified again
+	verified := map[plumbing.Hash]bool{}
+	sinceIter, err := s.repo.Log(&git.LogOptions{From: plumbing.NewHash(since)})
+	if err != nil {
+		return fmt.Errorf("failed to get commit history: %w", err)
+	}
+	err = sinceIter.ForEach(func(c *object.Commit) error {
+		verified[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to iterate through commits: %w", err)
+	}
+
+	iter, err := s.repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return fmt.Errorf("failed to get commit history: %w", err)
+	}
+	defer iter.Close()
+
+	return iter.ForEach(func(c *object.Commit) error {
+		if verified[c.Hash] {
+			return nil
+		}
+		if err := kr.Verify(c); err != nil {
+			return fmt.Errorf("commit %s: %w", c.Hash, err)
+		}
+		return nil
+	})
+}
+
+// isSSHSignature reports whether the signature is in the SSHSIG format
+// rather than an OpenPGP one.
+func isSSHSignature(signature string) bool {
+	return strings.HasPrefix(strings.TrimSpace(signature), sshSigArmorHead)
+}
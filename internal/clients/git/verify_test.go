@@ -0,0 +1,168 @@
+package git
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSSHKey(t *testing.T) (Signer, string) {
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(privKey, "")
+	require.NoError(t, err)
+	signer, err := NewSSHSigner(pem.EncodeToMemory(block), nil)
+	require.NoError(t, err)
+	pub, err := ssh.NewPublicKey(pubKey)
+	require.NoError(t, err)
+	return signer, string(ssh.MarshalAuthorizedKey(pub))
+}
+
+func commitTestFile(t *testing.T, repo *Repo, signer Signer, name string) string {
+	repo.signer = signer
+	file, err := repo.FS().OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte(name))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	hash, err := repo.Commit(name, "Add "+name, &IndexOptions{
+		OriginRepo: repo,
+		FromPath:   "/",
+		ToPath:     "/",
+	})
+	require.NoError(t, err)
+	return hash
+}
+
+func TestNewKeyring(t *testing.T) {
+	_, trusted := newTestSSHKey(t)
+
+	kr, err := NewKeyring("# platform team\n" + trusted + "\nteam@krateo.io " + trusted)
+	require.NoError(t, err)
+	assert.Len(t, kr.ssh, 2)
+
+	_, err = NewKeyring("")
+	assert.ErrorIs(t, err, ErrEmptyTrustedKeyring)
+
+	_, err = NewKeyring("not a key")
+	assert.ErrorIs(t, err, ErrInvalidTrustedKeyring)
+}
+
+func TestVerifyCommits(t *testing.T) {
+	baseRepo := BaseSuite{}
+	baseRepo.BuildBasicRepository()
+
+	trustedSigner, trustedKey := newTestSSHKey(t)
+	untrustedSigner, _ := newTestSSHKey(t)
+
+	kr, err := NewKeyring(trustedKey)
+	require.NoError(t, err)
+
+	clone := func(t *testing.T) *Repo {
+		repo, err := Clone(CloneOptions{
+			URL:    baseRepo.GetBasicLocalRepositoryURL(),
+			Branch: "master",
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { repo.Cleanup() })
+		return repo
+	}
+
+	t.Run("unsigned tip", func(t *testing.T) {
+		repo := clone(t)
+		err := repo.VerifyCommits(kr, "")
+		assert.ErrorIs(t, err, ErrCommitNotSigned)
+	})
+
+	t.Run("trusted tip", func(t *testing.T) {
+		repo := clone(t)
+		commitTestFile(t, repo, trustedSigner, "trusted.txt")
+		assert.NoError(t, repo.VerifyCommits(kr, ""))
+	})
+
+	t.Run("untrusted tip", func(t *testing.T) {
+		repo := clone(t)
+		commitTestFile(t, repo, untrustedSigner, "untrusted.txt")
+		err := repo.VerifyCommits(kr, "")
+		assert.ErrorIs(t, err, ErrCommitNotTrusted)
+	})
+
+	t.Run("openpgp keyring", func(t *testing.T) {
+		entity, err := openpgp.NewEntity("krateoctl", "", commitAuthorEmail, nil)
+		require.NoError(t, err)
+
+		var priv, pub bytes.Buffer
+		w, err := armor.Encode(&priv, openpgp.PrivateKeyType, nil)
+		require.NoError(t, err)
+		require.NoError(t, entity.SerializePrivate(w, nil))
+		require.NoError(t, w.Close())
+		w, err = armor.Encode(&pub, openpgp.PublicKeyType, nil)
+		require.NoError(t, err)
+		require.NoError(t, entity.Serialize(w))
+		require.NoError(t, w.Close())
+
+		signer, err := NewOpenPGPSigner(priv.Bytes(), nil)
+		require.NoError(t, err)
+
+		pgpKeyring, err := NewKeyring(trustedKey + pub.String())
+		require.NoError(t, err)
+		assert.Len(t, pgpKeyring.pgp, 1)
+
+		repo := clone(t)
+		commitTestFile(t, repo, signer, "openpgp.txt")
+		assert.NoError(t, repo.VerifyCommits(pgpKeyring, ""))
+
+		err = repo.VerifyCommits(kr, "")
+		assert.ErrorIs(t, err, ErrCommitNotTrusted)
+	})
+
+	t.Run("every commit since", func(t *testing.T) {
+		repo := clone(t)
+		since, err := repo.GetLatestCommit("master")
+		require.NoError(t, err)
+
+		commitTestFile(t, repo, trustedSigner, "first.txt")
+		commitTestFile(t, repo, trustedSigner, "second.txt")
+		assert.NoError(t, repo.VerifyCommits(kr, since))
+
+		commitTestFile(t, repo, nil, "unsigned.txt")
+		commitTestFile(t, repo, trustedSigner, "third.txt")
+		assert.NoError(t, repo.VerifyCommits(kr, ""))
+		err = repo.VerifyCommits(kr, since)
+		assert.ErrorIs(t, err, ErrCommitNotSigned)
+	})
+
+	t.Run("since not in history", func(t *testing.T) {
+		repo := clone(t)
+		since, err := repo.GetLatestCommit("master")
+		require.NoError(t, err)
+
+		ok, err := repo.InHistory(since)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		// a force-push leaves the last verified commit out of the history
+		rewritten := "0123456789abcdef0123456789abcdef01234567"
+		ok, err = repo.InHistory(rewritten)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		commitTestFile(t, repo, nil, "unsigned.txt")
+		commitTestFile(t, repo, trustedSigner, "trusted.txt")
+		assert.NoError(t, repo.VerifyCommits(kr, rewritten))
+
+		commitTestFile(t, repo, nil, "tip.txt")
+		err = repo.VerifyCommits(kr, rewritten)
+		assert.ErrorIs(t, err, ErrCommitNotSigned)
+	})
+}
@@ -3,17 +3,19 @@ package controllers
 import (
 	"github.com/krateoplatformops/provider-runtime/pkg/controller"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
 	"github.com/krateoplatformops/git-provider/internal/controllers/repo"
 )
 
 // Setup creates all controllers with the supplied logger and adds them to
-// the supplied manager.
-func Setup(mgr ctrl.Manager, o controller.Options) error {
-	for _, setup := range []func(ctrl.Manager, controller.Options) error{
+// the supplied manager. The Repos received from triggers, if not nil, are
+// reconciled immediately.
+func Setup(mgr ctrl.Manager, o controller.Options, triggers <-chan event.GenericEvent) error {
+	for _, setup := range []func(ctrl.Manager, controller.Options, <-chan event.GenericEvent) error{
 		repo.Setup,
 	} {
-		if err := setup(mgr, o); err != nil {
+		if err := setup(mgr, o, triggers); err != nil {
 			return err
 		}
 	}
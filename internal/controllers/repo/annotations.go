@@ -0,0 +1,29 @@
+package repo
+
+import (
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+)
+
+const (
+	// annotationSyncRequestedAt requests a synchronization, even if the target repo is up-to-date, each time its value
+	// changes. The request is performed immediately, regardless of the schedule and the sync windows. The handled value
+	// is echoed in status.lastHandledSyncRequest.
+	annotationSyncRequestedAt = "git.krateo.io/sync-requested-at"
+
+	// annotationPaused, set to "true", skips all the calls to the git servers
+	annotationPaused = "git.krateo.io/paused"
+)
+
+// isPaused returns true if the synchronization of the Repo is paused by annotation.
+func isPaused(cr *repov1alpha1.Repo) bool {
+	return cr.GetAnnotations()[annotationPaused] == "true"
+}
+
+// pendingSyncRequest returns the value of the sync request annotation if it was not handled yet, or an empty string.
+func pendingSyncRequest(cr *repov1alpha1.Repo) string {
+	req := cr.GetAnnotations()[annotationSyncRequestedAt]
+	if req == cr.Status.LastHandledSyncRequest {
+		return ""
+	}
+	return req
+}
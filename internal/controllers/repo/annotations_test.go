@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestObserveAnnotations(t *testing.T) {
+	ctx := context.TODO()
+	scheme := runtime.NewScheme()
+	require.NoError(t, repov1alpha1.SchemeBuilder.AddToScheme(scheme))
+
+	// a synchronized repo with updates disabled is observed without calling the git servers
+	newRepo := func(annotations map[string]string) *repov1alpha1.Repo {
+		return &repov1alpha1.Repo{
+			ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default", Annotations: annotations},
+			Spec: repov1alpha1.RepoSpec{
+				FromRepo: repov1alpha1.FromRepoOpts{RepoOpts: repov1alpha1.RepoOpts{Url: "https://git.invalid/origin", Branch: "main"}},
+				ToRepo:   repov1alpha1.ToRepoOpts{RepoOpts: repov1alpha1.RepoOpts{Url: "https://git.invalid/target", Branch: "main"}},
+			},
+			Status: repov1alpha1.RepoStatus{
+				OriginCommitId: "a", TargetCommitId: "b", OriginBranch: "main", TargetBranch: "main",
+			},
+		}
+	}
+	observe := func(cr *repov1alpha1.Repo) (bool, bool) {
+		e := &external{
+			kube: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).WithStatusSubresource(cr).Build(),
+			log:  logging.NewNopLogger(),
+			cfg:  &externalClientOpts{},
+			rec:  record.NewFakeRecorder(10),
+		}
+		obs, err := e.Observe(ctx, cr)
+		require.NoError(t, err)
+		return obs.ResourceExists, obs.ResourceUpToDate
+	}
+
+	exists, upToDate := observe(newRepo(nil))
+	assert.True(t, exists)
+	assert.True(t, upToDate)
+
+	t.Run("sync requested", func(t *testing.T) {
+		cr := newRepo(map[string]string{annotationSyncRequestedAt: "2024-01-15T12:00:00Z"})
+		exists, upToDate := observe(cr)
+		assert.True(t, exists)
+		assert.False(t, upToDate)
+
+		cr = newRepo(map[string]string{annotationSyncRequestedAt: "2024-01-15T12:00:00Z"})
+		cr.Status.LastHandledSyncRequest = "2024-01-15T12:00:00Z"
+		_, upToDate = observe(cr)
+		assert.True(t, upToDate, "request already handled")
+	})
+
+	t.Run("paused", func(t *testing.T) {
+		cr := newRepo(map[string]string{annotationPaused: "true", annotationSyncRequestedAt: "2024-01-15T12:00:00Z"})
+		cr.Status = repov1alpha1.RepoStatus{}
+		exists, upToDate := observe(cr)
+		assert.True(t, exists)
+		assert.True(t, upToDate)
+
+		now := metav1.Now()
+		cr.DeletionTimestamp = &now
+		cr.Finalizers = []string{"finalizer.managedresource.krateo.io"}
+		exists, _ = observe(cr)
+		assert.False(t, exists)
+	})
+}
@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+)
+
+// sniffLen is the number of leading bytes searched for a NUL byte, as git does.
+const sniffLen = 8000
+
+// binaryExtensions are the extensions of files always copied byte-for-byte.
+var binaryExtensions = map[string]bool{
+	// images
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".bmp": true, ".ico": true, ".webp": true, ".tif": true, ".tiff": true, ".psd": true,
+	// fonts
+	".ttf": true, ".otf": true, ".woff": true, ".woff2": true, ".eot": true,
+	// archives
+	".zip": true, ".gz": true, ".tgz": true, ".tar": true, ".bz2": true, ".xz": true, ".7z": true, ".rar": true, ".zst": true,
+	// binaries and bytecode
+	".jar": true, ".war": true, ".ear": true, ".class": true, ".exe": true, ".dll": true, ".so": true, ".dylib": true, ".a": true, ".o": true, ".wasm": true, ".pyc": true, ".bin": true,
+	// media and documents
+	".pdf": true, ".mp3": true, ".mp4": true, ".mov": true, ".avi": true, ".wav": true, ".ogg": true,
+}
+
+// loadGitAttributesEventually loads the `.gitattributes` files of the origin repo, they are used to detect binary files.
+func loadGitAttributesEventually(co *copier) error {
+	patterns, err := gitattributes.ReadPatterns(co.fromRepo.FS(), nil)
+	if err != nil {
+		return err
+	}
+	if len(patterns) > 0 {
+		co.attributes = gitattributes.NewMatcher(patterns)
+	}
+	return nil
+}
+
+/*
+isBinary reports whether the file must be copied byte-for-byte instead of being rendered, and why. A file is binary if:
+  - it is marked `binary` or `-diff` in `.gitattributes`
+  - its extension is a known binary one
+  - it contains a NUL byte in the first 8000 bytes
+  - it is not valid UTF-8
+*/
+func (co *copier) isBinary(src string, content []byte) (bool, string) {
+	if co.attributes != nil {
+		path := strings.Split(strings.TrimPrefix(filepath.ToSlash(src), "/"), "/")
+		attrs, matched := co.attributes.Match(path, []string{"binary", "diff"})
+		if matched {
+			if attr, ok := attrs["binary"]; ok && attr.IsSet() {
+				return true, "gitattributes binary"
+			}
+			if attr, ok := attrs["diff"]; ok && attr.IsUnset() {
+				return true, "gitattributes -diff"
+			}
+		}
+	}
+
+	if binaryExtensions[strings.ToLower(filepath.Ext(src))] {
+		return true, "binary extension"
+	}
+
+	sniff := content
+	if len(sniff) > sniffLen {
+		sniff = sniff[:sniffLen]
+	}
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return true, "NUL byte"
+	}
+
+	if !utf8.Valid(content) {
+		return true, "invalid UTF-8"
+	}
+
+	return false, ""
+}
@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyBinaryFiles(t *testing.T) {
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	origin, err := git.Clone(git.CloneOptions{
+		URL: baseRepo.GetBasicLocalRepositoryURL(),
+	})
+	require.NoError(t, err)
+	defer origin.Cleanup()
+
+	target, err := git.Clone(git.CloneOptions{
+		URL: baseRepo.GetBasicLocalRepositoryURL(),
+	})
+	require.NoError(t, err)
+	defer target.Cleanup()
+
+	template := "name: {{ name }}\n"
+	files := map[string][]byte{
+		"/.gitattributes":           []byte("*.dat binary\n*.lock -diff\n"),
+		"/skeleton/values.yaml":     []byte(template),
+		"/skeleton/logo.png":        []byte(template),
+		"/skeleton/data.dat":        []byte(template),
+		"/skeleton/deps.lock":       []byte(template),
+		"/skeleton/nul.txt":         append([]byte(template), 0),
+		"/skeleton/latin1.txt":      append([]byte(template), 0xe8),
+		"/skeleton/nested/app.conf": []byte(template),
+	}
+	for name, content := range files {
+		f, err := origin.FS().OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		require.NoError(t, err)
+		_, err = f.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	co := newCopier(origin, target, "/skeleton", "/rendered")
+	require.NoError(t, loadGitAttributesEventually(co))
+	createRenderFuncs(co, map[string]interface{}{"name": "krateo"}, renderOpts{})
+	require.NoError(t, co.copyDir("/skeleton", "/rendered"))
+
+	readTarget := func(t *testing.T, name string) []byte {
+		f, err := target.FS().Open(name)
+		require.NoError(t, err)
+		defer f.Close()
+		bin, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return bin
+	}
+
+	rendered := []byte("name: krateo\n")
+	assert.Equal(t, rendered, readTarget(t, "/rendered/values.yaml"))
+	assert.Equal(t, rendered, readTarget(t, "/rendered/nested/app.conf"))
+
+	for _, name := range []string{"logo.png", "data.dat", "deps.lock", "nul.txt", "latin1.txt"} {
+		assert.Equal(t, files["/skeleton/"+name], readTarget(t, "/rendered/"+name), name)
+	}
+}
@@ -1,12 +1,18 @@
 package repo
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
 	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
 
 	gi "github.com/sabhiram/go-gitignore"
 )
@@ -16,12 +22,41 @@ type copier struct {
 	toRepo          *git.Repo
 	originCopyPath  string
 	targetCopyPath  string
-	renderFunc      func(in io.Reader, out io.Writer) error
+	renderFunc      func(src string, in io.Reader, out io.Writer) error
 	renderFileNames func(src string) (string, error)
 	krateoIgnore    *gi.GitIgnore
 	targetIgnore    *gi.GitIgnore
+	// missing collects the unresolved variables found by strict render functions
+	missing []missingVariable
+	// attributes matches the `.gitattributes` of the origin repo
+	attributes gitattributes.Matcher
+	// rules excludes files and directories depending on the template values
+	rules *pathRules
+	// partials provides the template partials, their directory is never copied
+	partials *partialsProvider
+	// controlFiles are the origin paths of the files configuring the provider, such as the values schema, never copied
+	controlFiles map[string]bool
+	// protected matches the target paths that are never written
+	protected *gi.GitIgnore
+	// protectedSkipped collects the target paths not written because protected
+	protectedSkipped []string
+	// modes are the modes of the copied files by target path, relative to the root of the target repo
+	modes map[string]filemode.FileMode
+	// symlinks is how links are copied: `skip` (default), `preserve` or `dereference`
+	symlinks string
+	// dereferencing are the directories being copied through a dereferenced link
+	dereferencing map[string]bool
+	// skipEmptyNames skips the directories and files whose name renders empty instead of failing
+	skipEmptyNames bool
+	log            logging.Logger
 }
 
+var (
+	ErrInvalidName = errors.New("invalid rendered name")
+	// ErrPathTraversal is returned when a destination path escapes the target directory or touches the `.git` directory
+	ErrPathTraversal = errors.New("path traversal")
+)
+
 func newCopier(fromRepo, toRepo *git.Repo, originCopyPath, targetCopyPath string) *copier {
 	if originCopyPath == "" {
 		originCopyPath = "/"
@@ -37,27 +72,37 @@ func newCopier(fromRepo, toRepo *git.Repo, originCopyPath, targetCopyPath string
 	}
 }
 
+// copyFile copies src to dst, dst must be already rendered.
 func (co *copier) copyFile(src, dst string, doNotRender bool) (err error) {
 	fromFS, toFS := co.fromRepo.FS(), co.toRepo.FS()
 
-	if !doNotRender && co.renderFileNames != nil {
-		var err error
-		dst, err = co.renderFileNames(dst)
-		if err != nil {
-			return fmt.Errorf("failed to render file names: %w", err)
-		}
-	}
-
 	in, err := fromFS.Open(src)
 	if err != nil {
 		return fmt.Errorf("failed to open source file: %w", err)
 	}
 	defer in.Close()
 
-	out, err := toFS.Create(dst)
+	fi, err := fromFS.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat source file: %w", err)
+	}
+	mode, perm := filemode.Regular, os.FileMode(0644)
+	if fi.Mode().Perm()&0111 != 0 {
+		mode, perm = filemode.Executable, 0755
+	}
+
+	// OpenFile does not change the permissions of an existing file and follows links, such a file is replaced
+	if dfi, err := toFS.Lstat(dst); err == nil && (dfi.Mode()&os.ModeSymlink != 0 || dfi.Mode().Perm()&0111 != perm&0111) {
+		if err := toFS.Remove(dst); err != nil {
+			return fmt.Errorf("failed to replace destination file: %w", err)
+		}
+	}
+
+	out, err := toFS.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
 		return fmt.Errorf("failed to create destination file: %w", err)
 	}
+	co.setMode(dst, mode)
 
 	defer func() {
 		if e := out.Close(); e != nil {
@@ -66,16 +111,150 @@ func (co *copier) copyFile(src, dst string, doNotRender bool) (err error) {
 	}()
 
 	if doNotRender || co.renderFunc == nil {
+		co.debug("Copying file without rendering", "file", src, "reason", "ignored or no values")
 		_, err = io.Copy(out, in)
 		return err
 	}
 
-	return co.renderFunc(in, out)
+	content, err := io.ReadAll(in)
+	if err != nil {
+		return fmt.Errorf("failed to read source file: %w", err)
+	}
+
+	if binary, reason := co.isBinary(src, content); binary {
+		co.debug("Copying file without rendering", "file", src, "reason", reason)
+		_, err = out.Write(content)
+		return err
+	}
+
+	co.debug("Rendering file", "file", src)
+	return co.recordMissing(co.renderFunc(src, bytes.NewReader(content), out), src, false)
+}
+
+// setMode records the git mode of the target file dst.
+func (co *copier) setMode(dst string, mode filemode.FileMode) {
+	if co.modes == nil {
+		co.modes = map[string]filemode.FileMode{}
+	}
+	co.modes[strings.TrimPrefix(filepath.ToSlash(dst), "/")] = mode
 }
 
-// copyDir recursively copies a directory tree, attempting to preserve permissions.
-// Source directory must exist, destination directory must *not* exist.
-// Symlinks are ignored and skipped.
+func (co *copier) debug(msg string, keysAndValues ...any) {
+	if co.log != nil {
+		co.log.Debug(msg, keysAndValues...)
+	}
+}
+
+// recordMissing collects the unresolved variables of a missingVariablesError so that all of them can be reported at once, any other error is returned.
+func (co *copier) recordMissing(err error, src string, fileName bool) error {
+	var mve *missingVariablesError
+	if !errors.As(err, &mve) {
+		return err
+	}
+	for _, v := range mve.vars {
+		v.File = src
+		if fileName {
+			v.Line = 0
+		}
+		co.missing = append(co.missing, v)
+	}
+	return nil
+}
+
+// renderName renders a single directory or file name of src. It returns skip true if the name renders empty and empty names must be skipped.
+func (co *copier) renderName(src, name string) (rendered string, skip bool, err error) {
+	rendered, err = co.renderFileNames(name)
+	if err := co.recordMissing(err, src, true); err != nil {
+		return "", false, fmt.Errorf("failed to render name of %s: %w", src, err)
+	}
+	if err != nil {
+		// unresolved variables are reported once the copy is completed
+		return name, false, nil
+	}
+
+	switch {
+	case rendered == "" && co.skipEmptyNames:
+		return "", true, nil
+	case rendered == "":
+		return "", false, fmt.Errorf("%w: name of %s renders to an empty string", ErrInvalidName, src)
+	case escapesRoot(rendered) || isGitPath(rendered) || strings.HasPrefix(rendered, "/") || strings.HasPrefix(rendered, `\`):
+		return "", false, fmt.Errorf("%w: name of %s renders to %q", ErrPathTraversal, src, rendered)
+	case rendered == ".":
+		return "", false, fmt.Errorf("%w: name of %s renders to %q", ErrInvalidName, src, rendered)
+	case strings.ContainsAny(rendered, `/\`):
+		return "", false, fmt.Errorf("%w: name of %s renders to %q, which contains a path separator", ErrInvalidName, src, rendered)
+	}
+	return rendered, false, nil
+}
+
+// checkTargetPath returns an ErrPathTraversal error if path, a target path not cleaned yet, escapes the root of the target repo or touches its `.git` directory.
+func checkTargetPath(path string) error {
+	if escapesRoot(path) {
+		return fmt.Errorf("%w: %q is outside the target repository", ErrPathTraversal, path)
+	}
+	if isGitPath(path) {
+		return fmt.Errorf("%w: %q is inside the .git directory", ErrPathTraversal, path)
+	}
+	return nil
+}
+
+// escapesRoot reports whether path, relative to a root, leaves it through `..` segments.
+func escapesRoot(path string) bool {
+	depth := 0
+	for _, segment := range splitPath(path) {
+		switch segment {
+		case "", ".":
+		case "..":
+			depth--
+			if depth < 0 {
+				return true
+			}
+		default:
+			depth++
+		}
+	}
+	return false
+}
+
+// isGitPath reports whether a segment of path is `.git`, case insensitive as some filesystems are.
+func isGitPath(path string) bool {
+	for _, segment := range splitPath(path) {
+		if strings.EqualFold(strings.TrimRight(segment, ". "), ".git") {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPath splits path on both slashes and backslashes.
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' })
+}
+
+// renderPath renders each segment of path, empty segments are rejected.
+func (co *copier) renderPath(src, path string) (string, error) {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		rendered, skip, err := co.renderName(src, segment)
+		if err != nil {
+			return "", err
+		}
+		if skip {
+			return "", fmt.Errorf("%w: segment %q of %s renders to an empty string", ErrInvalidName, segment, path)
+		}
+		segments[i] = rendered
+	}
+	return filepath.Join(append([]string{"/"}, segments...)...), nil
+}
+
+/*
+copyDir recursively copies a directory tree, attempting to preserve permissions.
+Symlinks are skipped, preserved or dereferenced depending on the symlinks mode.
+The names of the destination directories and files are rendered one at a time, dst itself is rendered segment by segment.
+*/
 func (co *copier) copyDir(src, dst string) (err error) {
 	if len(src) == 0 {
 		src = "/"
@@ -85,12 +264,14 @@ func (co *copier) copyDir(src, dst string) (err error) {
 		dst = "/"
 	}
 
-	fromFS, toFS := co.fromRepo.FS(), co.toRepo.FS()
+	if err := checkTargetPath(dst); err != nil {
+		return err
+	}
 
 	src = filepath.Clean(src)
-	dst = filepath.Clean(dst)
+	dst = filepath.Join("/", dst)
 
-	si, err := fromFS.Stat(src)
+	si, err := co.fromRepo.FS().Stat(src)
 	if err != nil {
 		return fmt.Errorf("failed to stat source: %w", err)
 	}
@@ -98,37 +279,35 @@ func (co *copier) copyDir(src, dst string) (err error) {
 		return fmt.Errorf("source is not a directory")
 	}
 
-	doNotRender := false
-	doNotCopy := false
-	if co.krateoIgnore != nil {
-		if co.krateoIgnore.MatchesPath(src) {
-			doNotRender = true
-		}
+	if co.isTargetIgnored(src) {
+		return nil
 	}
-	if co.targetIgnore != nil {
-		relSrc, err := filepath.Rel(co.originCopyPath, src)
+	if co.renderFileNames != nil && !co.isRenderIgnored(src) {
+		dst, err = co.renderPath(src, dst)
 		if err != nil {
-			return fmt.Errorf("failed to get relative path: %w", err)
-		}
-		if co.targetIgnore.MatchesPath(filepath.Join(co.targetCopyPath, relSrc)) {
-			doNotCopy = true
+			return err
 		}
 	}
-	if doNotCopy {
-		return
+	if err := checkTargetPath(dst); err != nil {
+		return err
 	}
-	if !doNotRender && co.renderFileNames != nil {
-		dst, err = co.renderFileNames(dst)
+
+	return co.copyTree(src, dst)
+}
+
+// copyTree copies the content of the src directory into dst, which must be already rendered.
+// Git does not track the mode of directories, they are always created with 0755 permissions.
+func (co *copier) copyTree(src, dst string) (err error) {
+	fromFS, toFS := co.fromRepo.FS(), co.toRepo.FS()
+
+	// the content of a protected directory is walked anyway, to report each file not written
+	if !co.isProtected(dst) {
+		err = toFS.MkdirAll(dst, 0755)
 		if err != nil {
-			return fmt.Errorf("failed to render file names: %w", err)
+			return
 		}
 	}
 
-	err = toFS.MkdirAll(dst, si.Mode())
-	if err != nil {
-		return
-	}
-
 	entries, err := fromFS.ReadDir(src)
 	if err != nil {
 		return
@@ -136,45 +315,120 @@ func (co *copier) copyDir(src, dst string) (err error) {
 
 	for _, entry := range entries {
 		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
 
-		if entry.IsDir() {
-			err = co.copyDir(srcPath, dstPath)
+		// Skip the metadata of the origin repo, when copying from its root.
+		if entry.IsDir() && isGitPath(entry.Name()) {
+			continue
+		}
+
+		isLink := entry.Mode()&os.ModeSymlink != 0
+		if isLink && co.symlinks != symlinksPreserve && co.symlinks != symlinksDereference {
+			continue
+		}
+		if co.isTargetIgnored(srcPath) {
+			continue
+		}
+		if co.partials.contains(srcPath) {
+			co.debug("Skipping partials directory", "path", srcPath)
+			continue
+		}
+		if co.controlFiles[filepath.Clean(srcPath)] {
+			co.debug("Skipping control file", "path", srcPath)
+			continue
+		}
+		if co.isExcludedByRules(srcPath) {
+			co.debug("Skipping path excluded by rules", "path", srcPath)
+			continue
+		}
+
+		doNotRender := co.isRenderIgnored(srcPath)
+		name := entry.Name()
+		if !doNotRender && co.renderFileNames != nil {
+			rendered, skip, err := co.renderName(srcPath, name)
 			if err != nil {
-				return
+				return err
 			}
-		} else {
-			// Skip symlinks.
-			if entry.Mode()&os.ModeSymlink != 0 {
+			if skip {
+				co.debug("Skipping file with empty rendered name", "file", srcPath)
 				continue
 			}
+			name = rendered
+		}
+		dstPath := filepath.Join(dst, name)
+		if rel, err := filepath.Rel(dst, dstPath); err != nil || checkTargetPath(rel) != nil {
+			return fmt.Errorf("%w: %s renders to %q, outside of %s", ErrPathTraversal, srcPath, dstPath, dst)
+		}
 
-			doNotRender := false
-			doNotCopy := false
-			if co.krateoIgnore != nil {
-				if co.krateoIgnore.MatchesPath(srcPath) {
-					doNotRender = true
-				}
-			}
-			if co.targetIgnore != nil {
-				relSrc, err := filepath.Rel(co.originCopyPath, srcPath)
-				if err != nil {
-					return fmt.Errorf("failed to get relative path: %w", err)
-				}
-				if co.targetIgnore.MatchesPath(filepath.Join(co.targetCopyPath, relSrc)) {
-					doNotCopy = true
-				}
-			}
-
-			// do the copy
-			if !doNotCopy {
-				err = co.copyFile(srcPath, dstPath, doNotRender)
-				if err != nil {
-					return
-				}
-			}
+		switch {
+		case isLink && co.symlinks == symlinksDereference:
+			err = co.copyDereferenced(srcPath, dstPath, doNotRender)
+		case entry.IsDir():
+			err = co.copyTree(srcPath, dstPath)
+		case co.isProtected(dstPath):
+			co.debug("Skipping protected path", "file", srcPath, "target", dstPath)
+			co.protectedSkipped = append(co.protectedSkipped, dstPath)
+		case isLink:
+			err = co.preserveSymlink(srcPath, dstPath)
+		default:
+			err = co.copyFile(srcPath, dstPath, doNotRender)
+		}
+		if err != nil {
+			return
 		}
 	}
 
 	return
 }
+
+// isRenderIgnored reports whether src matches the `.krateoignore` of the origin repo.
+func (co *copier) isRenderIgnored(src string) bool {
+	return co.krateoIgnore != nil && co.krateoIgnore.MatchesPath(src)
+}
+
+// isTargetIgnored reports whether the target path of src already exists in the target repo and must be preserved.
+func (co *copier) isTargetIgnored(src string) bool {
+	if co.targetIgnore == nil {
+		return false
+	}
+	relSrc, err := filepath.Rel(co.originCopyPath, src)
+	if err != nil {
+		return false
+	}
+	return co.targetIgnore.MatchesPath(filepath.Join(co.targetCopyPath, relSrc))
+}
+
+// isExcludedByRules reports whether src matches a rule excluding it from the copy.
+func (co *copier) isExcludedByRules(src string) bool {
+	if co.rules == nil {
+		return false
+	}
+	rel, err := filepath.Rel(co.originCopyPath, src)
+	if err != nil {
+		return false
+	}
+	return co.rules.isExcluded(filepath.ToSlash(rel))
+}
+
+// defaultProtectedPaths are always protected, before the paths of the spec: a spec path can only unprotect them by negation.
+var defaultProtectedPaths = []string{".git", ".github/workflows", "CODEOWNERS"}
+
+// controlFiles returns the origin paths of the files configuring the provider, given relative to the root of the repository.
+func controlFiles(paths ...string) map[string]bool {
+	res := map[string]bool{}
+	for _, p := range paths {
+		if len(p) > 0 {
+			res[filepath.Join("/", p)] = true
+		}
+	}
+	return res
+}
+
+// compileProtectedPaths compiles the default and the given protected paths of the target repo, in `.gitignore` format.
+func compileProtectedPaths(paths []string) *gi.GitIgnore {
+	return gi.CompileIgnoreLines(append(append([]string{}, defaultProtectedPaths...), paths...)...)
+}
+
+// isProtected reports whether dst, a path of the target repo, is protected.
+func (co *copier) isProtected(dst string) bool {
+	return co.protected != nil && co.protected.MatchesPath(strings.TrimPrefix(filepath.ToSlash(dst), "/"))
+}
@@ -1,13 +1,52 @@
 package repo
 
 import (
+	"io"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// newTestRepo clones the repository at url and writes the files, by absolute path, into its worktree.
+func newTestRepo(t *testing.T, url string, files map[string]string) *git.Repo {
+	return newTestRepoWithLinks(t, url, files, nil)
+}
+
+// newTestRepoWithLinks is newTestRepo that also creates the symbolic links, by absolute path, to their target.
+func newTestRepoWithLinks(t *testing.T, url string, files, links map[string]string) *git.Repo {
+	repo, err := git.Clone(git.CloneOptions{URL: url, Branch: "master"})
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Cleanup() })
+	for name, content := range files {
+		require.NoError(t, repo.FS().MkdirAll(name[:strings.LastIndex(name, "/")], 0755))
+		f, err := repo.FS().OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	for link, target := range links {
+		require.NoError(t, repo.FS().MkdirAll(link[:strings.LastIndex(link, "/")], 0755))
+		require.NoError(t, repo.FS().Symlink(target, link))
+	}
+	return repo
+}
+
+// readTestFile returns the content of the file name of the worktree of repo.
+func readTestFile(t *testing.T, repo *git.Repo, name string) string {
+	f, err := repo.FS().Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	bin, err := io.ReadAll(f)
+	require.NoError(t, err)
+	return string(bin)
+}
+
 func TestCopier(t *testing.T) {
 	baseRepo := git.BaseSuite{}
 	baseRepo.BuildBasicRepository()
@@ -41,3 +80,321 @@ func TestCopier(t *testing.T) {
 	err = co.copyDir("/", "/")
 	require.NoError(t, err)
 }
+
+func TestCopyDirRendersNames(t *testing.T) {
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	exists := func(t *testing.T, repo *git.Repo, name string) bool {
+		_, err := repo.FS().Stat(name)
+		return err == nil
+	}
+
+	values := map[string]interface{}{"team": "core", "app": "api", "env": "prod", "empty": "", "none": "", "slash": "a/b"}
+
+	tests := []struct {
+		name      string
+		opts      renderOpts
+		skipEmpty bool
+		files     map[string]string
+		expected  []string
+		skipped   []string
+		wantErr   error
+	}{
+		{
+			name:     "nested directories mustache",
+			files:    map[string]string{"/skeleton/{{ team }}/{{ app }}/{{ env }}.yaml": "app: {{ app }}\n"},
+			expected: []string{"/rendered/core/api/prod.yaml"},
+		},
+		{
+			name:     "nested directories gotemplate",
+			opts:     renderOpts{engine: "gotemplate"},
+			files:    map[string]string{"/skeleton/{{ .team }}/{{ .app }}/{{ .env }}.yaml": "app: {{ .app }}\n"},
+			expected: []string{"/rendered/core/api/prod.yaml"},
+		},
+		{
+			name:     "custom delimiters mustache",
+			opts:     renderOpts{pathDelimiters: [2]string{"[[", "]]"}},
+			files:    map[string]string{"/skeleton/[[ team ]]/{{ app }}.yaml": "app: {{ app }}\n"},
+			expected: []string{"/rendered/core/{{ app }}.yaml"},
+		},
+		{
+			name:     "custom delimiters gotemplate",
+			opts:     renderOpts{engine: "gotemplate", pathDelimiters: [2]string{"[[", "]]"}},
+			files:    map[string]string{"/skeleton/[[ .team ]]/[[ .app ]].yaml": "app: {{ .app }}\n"},
+			expected: []string{"/rendered/core/api.yaml"},
+		},
+		{
+			name:    "empty name",
+			files:   map[string]string{"/skeleton/{{ empty }}": "app: {{ app }}\n"},
+			wantErr: ErrInvalidName,
+		},
+		{
+			name:      "skip empty names",
+			skipEmpty: true,
+			files: map[string]string{
+				"/skeleton/{{ none }}":            "app: {{ app }}\n",
+				"/skeleton/{{ empty }}/app.yaml":  "app: {{ app }}\n",
+				"/skeleton/{{ app }}/values.yaml": "app: {{ app }}\n",
+			},
+			expected: []string{"/rendered/api/values.yaml"},
+			skipped:  []string{"/rendered/app.yaml"},
+		},
+		{
+			name:    "path separator",
+			files:   map[string]string{"/skeleton/{{ slash }}.yaml": "app: {{ app }}\n"},
+			wantErr: ErrInvalidName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := newTestRepo(t, url, tt.files)
+			target := newTestRepo(t, url, nil)
+
+			co := newCopier(origin, target, "/skeleton", "/rendered")
+			co.skipEmptyNames = tt.skipEmpty
+			createRenderFuncs(co, values, tt.opts)
+
+			err := co.copyDir("/skeleton", "/rendered")
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			for _, name := range tt.expected {
+				f, err := target.FS().Open(name)
+				require.NoError(t, err, name)
+				content, err := io.ReadAll(f)
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+				assert.Equal(t, "app: api\n", string(content), name)
+			}
+			for _, name := range tt.skipped {
+				assert.False(t, exists(t, target, name), name)
+			}
+		})
+	}
+
+	t.Run("templated target path", func(t *testing.T) {
+		origin := newTestRepo(t, url, map[string]string{"/skeleton/app.yaml": "app: {{ app }}\n"})
+		target := newTestRepo(t, url, nil)
+
+		co := newCopier(origin, target, "/skeleton", "/{{ team }}/{{ env }}")
+		createRenderFuncs(co, values, renderOpts{})
+		require.NoError(t, co.copyDir("/skeleton", "/{{ team }}/{{ env }}"))
+		assert.True(t, exists(t, target, "/core/prod/app.yaml"))
+	})
+}
+
+func TestCopyDirPathTraversal(t *testing.T) {
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	e := &external{}
+
+	// the malicious value is rendered in a directory name with mustache and in a file name with gotemplate
+	skeletons := map[string]map[string]string{
+		"mustache":   {"/skeleton/{{{ evil }}}/x": "pwned\n"},
+		"gotemplate": {"/skeleton/app/{{ .evil }}": "pwned\n"},
+	}
+
+	for _, evil := range []string{"../../.git/hooks/pre-commit", "../outside", "..", "/etc/passwd", `\etc\passwd`, ".git", ".GIT", "hooks/../../x"} {
+		for engine, files := range skeletons {
+			t.Run(engine+" "+evil, func(t *testing.T) {
+				origin := newTestRepo(t, url, files)
+				target := newTestRepo(t, url, nil)
+
+				co := newCopier(origin, target, "/skeleton", "/rendered")
+				createRenderFuncs(co, map[string]interface{}{"evil": evil}, renderOpts{engine: engine})
+
+				err := e.copyToTarget(co, true, "/skeleton", "/rendered")
+				require.ErrorIs(t, err, ErrPathTraversal)
+
+				_, err = target.FS().Stat("/.git/hooks/pre-commit")
+				assert.True(t, os.IsNotExist(err))
+				_, err = target.FS().Stat("/outside")
+				assert.True(t, os.IsNotExist(err))
+			})
+		}
+	}
+
+	for _, toPath := range []string{"../outside", "/rendered/../../outside", "/.git/hooks", "/{{ evil }}"} {
+		t.Run("target path "+toPath, func(t *testing.T) {
+			origin := newTestRepo(t, url, map[string]string{"/skeleton/app.yaml": "app: {{ app }}\n"})
+			target := newTestRepo(t, url, nil)
+
+			co := newCopier(origin, target, "/skeleton", toPath)
+			createRenderFuncs(co, map[string]interface{}{"evil": "../.."}, renderOpts{})
+
+			require.ErrorIs(t, e.copyToTarget(co, true, "/skeleton", toPath), ErrPathTraversal)
+		})
+	}
+
+	t.Run("origin .git is not copied", func(t *testing.T) {
+		origin := newTestRepo(t, url, map[string]string{"/app.yaml": "app: {{ app }}\n"})
+		target := newTestRepo(t, url, nil)
+
+		co := newCopier(origin, target, "/", "/rendered")
+		createRenderFuncs(co, map[string]interface{}{"app": "api"}, renderOpts{})
+
+		require.NoError(t, e.copyToTarget(co, true, "/", "/rendered"))
+		_, err := target.FS().Stat("/rendered/app.yaml")
+		require.NoError(t, err)
+		_, err = target.FS().Stat("/rendered/.git")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestCopyDirProtectedPaths(t *testing.T) {
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	origin := newTestRepo(t, url, map[string]string{
+		"/skeleton/.github/workflows/ci.yml":  "rendered\n",
+		"/skeleton/.github/workflows/new.yml": "rendered\n",
+		"/skeleton/.github/dependabot.yml":    "rendered\n",
+		"/skeleton/CODEOWNERS":                "rendered\n",
+		"/skeleton/docs/CODEOWNERS":           "rendered\n",
+		"/skeleton/app.yaml":                  "rendered\n",
+	})
+	target := newTestRepo(t, url, map[string]string{
+		"/.github/workflows/ci.yml": "original\n",
+		"/CODEOWNERS":               "original\n",
+	})
+
+	co := newCopier(origin, target, "/skeleton", "/")
+	// the defaults are protected even if the spec lists other paths
+	co.protected = compileProtectedPaths([]string{"/deploy/production/"})
+	e := &external{}
+	require.NoError(t, e.copyToTarget(co, true, "/skeleton", "/"))
+
+	assert.ElementsMatch(t, []string{
+		"/.github/workflows/ci.yml",
+		"/.github/workflows/new.yml",
+		"/CODEOWNERS",
+		"/docs/CODEOWNERS",
+	}, co.protectedSkipped)
+
+	assert.Equal(t, "original\n", readTestFile(t, target, "/.github/workflows/ci.yml"))
+	assert.Equal(t, "original\n", readTestFile(t, target, "/CODEOWNERS"))
+	assert.Equal(t, "rendered\n", readTestFile(t, target, "/.github/dependabot.yml"))
+	assert.Equal(t, "rendered\n", readTestFile(t, target, "/app.yaml"))
+	for _, name := range []string{"/.github/workflows/new.yml", "/docs/CODEOWNERS"} {
+		_, err := target.FS().Stat(name)
+		assert.True(t, os.IsNotExist(err), name)
+	}
+
+	t.Run("defaults unprotected by negation", func(t *testing.T) {
+		co := newCopier(origin, target, "/skeleton", "/")
+		co.protected = compileProtectedPaths([]string{"!CODEOWNERS"})
+		assert.True(t, co.isProtected("/.github/workflows/ci.yml"))
+		assert.True(t, co.isProtected("/.git/config"))
+		assert.False(t, co.isProtected("/CODEOWNERS"))
+		assert.False(t, co.isProtected("/docs/CODEOWNERS"))
+	})
+
+	t.Run("squash keeps protected paths", func(t *testing.T) {
+		_, err := target.Commit(".", "Render", &git.IndexOptions{OriginRepo: origin, FromPath: "/skeleton", ToPath: "/"})
+		require.NoError(t, err)
+
+		require.NoError(t, target.Orphan(func(path string) bool { return co.isProtected(path) }))
+		assert.Equal(t, "original\n", readTestFile(t, target, "/CODEOWNERS"))
+		assert.Equal(t, "original\n", readTestFile(t, target, "/.github/workflows/ci.yml"))
+		_, err = target.FS().Stat("/.github/dependabot.yml")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestCopyDirFileModes(t *testing.T) {
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	origin, err := git.Clone(git.CloneOptions{URL: url, Branch: "master"})
+	require.NoError(t, err)
+	defer origin.Cleanup()
+	target, err := git.Clone(git.CloneOptions{URL: url, Branch: "master"})
+	require.NoError(t, err)
+	defer target.Cleanup()
+
+	files := map[string]os.FileMode{
+		"/skeleton/{{ name }}/bin/run.sh":       0755,
+		"/skeleton/{{ name }}/{{ name }}.sh":    0755,
+		"/skeleton/{{ name }}/README.md":        0644,
+		"/skeleton/scripts/{{ name }}-build.sh": 0700,
+	}
+	for name, perm := range files {
+		require.NoError(t, origin.FS().MkdirAll(name[:strings.LastIndex(name, "/")], 0755))
+		f, err := origin.FS().OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("echo {{ name }}\n"))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	// an existing non executable file becomes executable
+	require.NoError(t, target.FS().MkdirAll("/rendered/krateo/bin", 0755))
+	f, err := target.FS().OpenFile("/rendered/krateo/bin/run.sh", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// an existing link is replaced, not written through
+	require.NoError(t, target.FS().Symlink("../../../outside", "/rendered/krateo/README.md"))
+
+	co := newCopier(origin, target, "/skeleton", "/rendered")
+	createRenderFuncs(co, map[string]interface{}{"name": "krateo"}, renderOpts{})
+	require.NoError(t, co.copyDir("/skeleton", "/rendered"))
+	_, err = target.FS().Lstat("/outside")
+	assert.True(t, os.IsNotExist(err))
+
+	expected := map[string]filemode.FileMode{
+		"rendered/krateo/bin/run.sh":       filemode.Executable,
+		"rendered/krateo/krateo.sh":        filemode.Executable,
+		"rendered/krateo/README.md":        filemode.Regular,
+		"rendered/scripts/krateo-build.sh": filemode.Executable,
+	}
+	assert.Equal(t, expected, co.modes)
+	for name, mode := range expected {
+		fi, err := target.FS().Lstat(name)
+		require.NoError(t, err, name)
+		assert.Zero(t, fi.Mode()&os.ModeSymlink, name)
+		assert.Equal(t, mode == filemode.Executable, fi.Mode().Perm()&0111 != 0, name)
+	}
+
+	// the index agrees with the worktree, a second commit has nothing to add
+	opts := &git.IndexOptions{OriginRepo: origin, FromPath: "/skeleton", ToPath: "/rendered", Modes: co.modes}
+	_, err = target.Commit(".", "Render", opts)
+	require.NoError(t, err)
+	_, err = target.Commit(".", "Render again", opts)
+	assert.ErrorIs(t, err, git.NoErrAlreadyUpToDate)
+}
+
+func TestCopyDirControlFiles(t *testing.T) {
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	origin := newTestRepo(t, url, map[string]string{
+		"/.krateo/values.schema.json": `{"type": "object"}`,
+		"/.krateo/rules.yaml":         "rules: []\n",
+		"/.krateo/notes.md":           "notes\n",
+		"/app.yaml":                   "app\n",
+	})
+	target := newTestRepo(t, url, nil)
+
+	co := newCopier(origin, target, "/", "/")
+	co.controlFiles = controlFiles(".krateo/values.schema.json", ".krateo/rules.yaml", "")
+	e := &external{}
+	require.NoError(t, e.copyToTarget(co, true, "/", "/"))
+
+	assert.Equal(t, "app\n", readTestFile(t, target, "/app.yaml"))
+	assert.Equal(t, "notes\n", readTestFile(t, target, "/.krateo/notes.md"))
+	for _, name := range []string{"/.krateo/values.schema.json", "/.krateo/rules.yaml"} {
+		_, err := target.FS().Stat(name)
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
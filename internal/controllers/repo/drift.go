@@ -0,0 +1,119 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	driftDetectionContent = "content"
+
+	// maxDriftedPaths is the number of drifted paths listed in the condition message
+	maxDriftedPaths = 10
+)
+
+// observeContent sets the ContentInSync condition comparing the target branch with the render of the origin repo,
+// and returns true if the drifted content must be re-applied.
+func (e *external) observeContent(ctx context.Context, cr *repov1alpha1.Repo) (bool, error) {
+	drifted, err := e.detectDrift(ctx, cr)
+	if err != nil {
+		e.log.Debug("Unable to detect content drift", "msg", err.Error())
+		return false, fmt.Errorf("unable to detect content drift: %w", err)
+	}
+	if len(drifted) == 0 {
+		cr.SetConditions(repov1alpha1.ContentInSync())
+		return false, nil
+	}
+
+	listed := drifted
+	if len(listed) > maxDriftedPaths {
+		listed = append(listed[:maxDriftedPaths:maxDriftedPaths], "...")
+	}
+	msg := fmt.Sprintf("%d files of the target branch differ from the render of origin commit %s: %s",
+		len(drifted), cr.Status.OriginCommitId, strings.Join(listed, ", "))
+	cr.SetConditions(repov1alpha1.ContentDrifted(msg))
+
+	reapply := cr.Spec.EnableUpdate && cr.Spec.Override
+	e.log.Info("Target repo content drifted", "files", len(drifted), "reapply", reapply)
+	if reapply {
+		e.rec.Eventf(cr, corev1.EventTypeWarning, string(repov1alpha1.ReasonContentDrifted), "%s, re-applying the content", msg)
+	} else {
+		e.rec.Eventf(cr, corev1.EventTypeWarning, string(repov1alpha1.ReasonContentDrifted),
+			"%s, not re-applying the content since enableUpdate or override is false", msg)
+	}
+	return reapply, nil
+}
+
+// detectDrift renders the origin repo at status.originCommitId over the target branch, overriding the existing files,
+// and returns the files under the target path that would change.
+func (e *external) detectDrift(ctx context.Context, cr *repov1alpha1.Repo) ([]string, error) {
+	spec := cr.Spec.DeepCopy()
+
+	toRepo, err := e.cloneTarget(spec)
+	if err != nil {
+		return nil, fmt.Errorf("cloning toRepo: %w", err)
+	}
+	defer toRepo.Cleanup()
+
+	fromRepo, err := e.cloneOrigin(spec)
+	if err != nil {
+		return nil, fmt.Errorf("cloning fromRepo: %w", err)
+	}
+	defer fromRepo.Cleanup()
+
+	if err := fromRepo.Checkout(cr.Status.OriginCommitId); err != nil {
+		return nil, err
+	}
+	tip, err := toRepo.GetLatestCommit(toRepo.CurrentBranch())
+	if err != nil {
+		return nil, fmt.Errorf("unable to get latest commit from target repo: %w", err)
+	}
+
+	// drift detection runs at every poll: the events and conditions of the render are reported by the synchronization only
+	r, err := e.renderTarget(ctx, spec, fromRepo, toRepo, true, &renderReport{})
+	if err != nil {
+		return nil, err
+	}
+	commitId, err := toRepo.Commit(".", "drift detection", &git.IndexOptions{
+		OriginRepo: fromRepo,
+		FromPath:   r.fromPath,
+		ToPath:     r.toPath,
+		Modes:      r.co.modes,
+	})
+	if err == git.NoErrAlreadyUpToDate {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to commit target repo: %w", err)
+	}
+
+	actual, err := toRepo.TreeHash(tip, r.toPath)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := toRepo.TreeHash(commitId, r.toPath)
+	if err != nil {
+		return nil, err
+	}
+	if actual == expected {
+		return nil, nil
+	}
+
+	changes, _, err := toRepo.Diff(tip, commitId)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(r.toPath, "/")
+	var drifted []string
+	for _, ch := range changes {
+		if prefix == "" || ch.Path == prefix || strings.HasPrefix(ch.Path, prefix+"/") {
+			drifted = append(drifted, ch.Path)
+		}
+	}
+	return drifted, nil
+}
@@ -0,0 +1,102 @@
+package repo
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDetectDrift(t *testing.T) {
+	ctx := context.TODO()
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	// the target branch is a copy of master, the origin branch
+	repo, err := git.Clone(git.CloneOptions{URL: url, Branch: "master"})
+	require.NoError(t, err)
+	defer repo.Cleanup()
+	originCommitId, err := repo.GetLatestCommit("master")
+	require.NoError(t, err)
+	require.NoError(t, repo.Push("origin", "drift", false, nil))
+
+	rec := record.NewFakeRecorder(10)
+	e := &external{
+		kube: fake.NewFakeClient(),
+		log:  logging.NewNopLogger(),
+		cfg:  &externalClientOpts{},
+		rec:  rec,
+	}
+	cr := &repov1alpha1.Repo{
+		Spec: repov1alpha1.RepoSpec{
+			FromRepo:       repov1alpha1.FromRepoOpts{RepoOpts: repov1alpha1.RepoOpts{Url: url, Branch: "master", Path: "/go"}},
+			ToRepo:         repov1alpha1.ToRepoOpts{RepoOpts: repov1alpha1.RepoOpts{Url: url, Branch: "drift", Path: "/go"}},
+			DriftDetection: driftDetectionContent,
+		},
+		Status: repov1alpha1.RepoStatus{OriginCommitId: originCommitId},
+	}
+
+	drifted, err := e.detectDrift(ctx, cr)
+	require.NoError(t, err)
+	assert.Empty(t, drifted)
+	// the render of drift detection has no side effects, e.g. the missing '.krateoignore' is not reported at each poll
+	assert.Empty(t, rec.Events)
+	assert.Empty(t, cr.Status.Conditions)
+
+	reapply, err := e.observeContent(ctx, cr)
+	require.NoError(t, err)
+	assert.False(t, reapply)
+	assert.Equal(t, metav1.ConditionTrue, cr.GetCondition(repov1alpha1.TypeContentInSync).Status)
+
+	// a commit outside of the target path is not a drift
+	target, err := git.Clone(git.CloneOptions{URL: url, Branch: "drift"})
+	require.NoError(t, err)
+	defer target.Cleanup()
+	write := func(name, content string) {
+		f, err := target.FS().OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	commitAndPush := func(msg string) {
+		_, err := target.Commit(".", msg, &git.IndexOptions{OriginRepo: target, FromPath: "/", ToPath: "/"})
+		require.NoError(t, err)
+		require.NoError(t, target.Push("origin", "drift", false, nil))
+	}
+	write("CHANGELOG", "edited outside of the target path\n")
+	commitAndPush("Edit CHANGELOG")
+
+	drifted, err = e.detectDrift(ctx, cr)
+	require.NoError(t, err)
+	assert.Empty(t, drifted)
+
+	write("go/example.go", "package main\n// edited by hand\n")
+	commitAndPush("Edit generated file")
+
+	drifted, err = e.detectDrift(ctx, cr)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go/example.go"}, drifted)
+
+	reapply, err = e.observeContent(ctx, cr)
+	require.NoError(t, err)
+	assert.False(t, reapply, "enableUpdate and override are false")
+	cond := cr.GetCondition(repov1alpha1.TypeContentInSync)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, repov1alpha1.ReasonContentDrifted, cond.Reason)
+	assert.Contains(t, cond.Message, "go/example.go")
+
+	cr.Spec.EnableUpdate, cr.Spec.Override = true, true
+	reapply, err = e.observeContent(ctx, cr)
+	require.NoError(t, err)
+	assert.True(t, reapply)
+}
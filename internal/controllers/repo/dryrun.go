@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	commonv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	"github.com/krateoplatformops/provider-runtime/pkg/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+var errDryRunConfigMapNotOwned = errors.New("refusing to write the dry run diff to a configmap not owned by the repo")
+
+const (
+	dryRunDiffKey = "diff"
+	// maxDryRunDiffSize keeps the configmap well below the 1MiB limit of the objects stored in etcd
+	maxDryRunDiffSize = 512 * 1024
+	maxDryRunFiles    = 100
+)
+
+// observeDryRun reports the resource up-to-date if the last dry run rendered the latest origin commit with the current values and spec.
+func (e *external) observeDryRun(ctx context.Context, cr *repov1alpha1.Repo) (reconciler.ExternalObservation, error) {
+	latestCommit, err := git.GetLatestCommitRemote(git.ListOptions{
+		URL:        cr.Spec.FromRepo.Url,
+		Auth:       e.cfg.FromRepoCreds,
+		Insecure:   e.cfg.Insecure,
+		Branch:     cr.Spec.FromRepo.Branch,
+		GitCookies: e.cfg.FromRepoCookieFile,
+		HomeDir:    homeDir,
+	})
+	if err != nil {
+		e.log.Debug("Unable to get latest commit from origin remote repository", "msg", err.Error())
+		return reconciler.ExternalObservation{}, err
+	}
+
+	values, err := e.loadValues(ctx, &cr.Spec)
+	if err != nil {
+		e.log.Debug("Unable to load template values", "msg", err.Error())
+	}
+	hash, err := valuesHash(values)
+	if err != nil {
+		return reconciler.ExternalObservation{}, err
+	}
+
+	// the resource always exists, so that the dry run is performed by Update regardless of enableUpdate
+	st := cr.Status.DryRun
+	if st == nil || st.ObservedGeneration != cr.Generation || st.OriginCommitId != *latestCommit || st.ValuesHash != hash {
+		e.log.Debug("Dry run outdated", "originCommitId", *latestCommit, "valuesHash", hash)
+		return reconciler.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: false,
+		}, nil
+	}
+
+	cr.Status.SetConditions(commonv1.Available())
+	return reconciler.ExternalObservation{
+		ResourceExists:   true,
+		ResourceUpToDate: true,
+	}, nil
+}
+
+// dryRun commits the rendered files in the local clone of the target repo, without pushing them, and records the
+// changes against targetCommitId in the status and in the diff configmap.
+func (e *external) dryRun(ctx context.Context, cr *repov1alpha1.Repo, toRepo *git.Repo, opts *git.IndexOptions, targetCommitId, originCommitId, valuesHash string) error {
+	var (
+		changes []git.FileChange
+		diff    string
+	)
+	commitId, err := toRepo.Commit(".", "dry run", opts)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("unable to commit target repo: %w", err)
+	}
+	if err == nil {
+		changes, diff, err = toRepo.Diff(targetCommitId, commitId)
+		if err != nil {
+			return fmt.Errorf("unable to compute dry run diff: %w", err)
+		}
+	}
+
+	st := newDryRunStatus(changes)
+	st.ObservedGeneration = cr.Generation
+	st.OriginCommitId = originCommitId
+	st.TargetCommitId = targetCommitId
+	st.ValuesHash = valuesHash
+
+	diff, st.DiffTruncated = truncateDiff(diff, maxDryRunDiffSize)
+	st.DiffConfigMapRef, err = e.storeDryRunDiff(ctx, cr, diff)
+	if err != nil {
+		return fmt.Errorf("unable to store dry run diff: %w", err)
+	}
+
+	e.log.Info("Dry run completed", "added", st.Added, "modified", st.Modified, "deleted", st.Deleted, "modeChanged", st.ModeChanged)
+	e.rec.Eventf(cr, corev1.EventTypeNormal, "DryRunCompleted",
+		"Dry run: %d files added, %d modified, %d deleted, diff in configmap %s", st.Added, st.Modified, st.Deleted, st.DiffConfigMapRef.Name)
+
+	cr.Status.DryRun = st
+	cr.Status.LastHandledSyncRequest = cr.GetAnnotations()[annotationSyncRequestedAt]
+	cr.Status.SetConditions(commonv1.Available())
+	if err := e.kube.Status().Update(ctx, cr); err != nil {
+		return fmt.Errorf("unable to update status: %w", err)
+	}
+	return nil
+}
+
+// newDryRunStatus summarizes the changes, listing at most maxDryRunFiles files.
+func newDryRunStatus(changes []git.FileChange) *repov1alpha1.DryRunStatus {
+	st := &repov1alpha1.DryRunStatus{}
+	for _, ch := range changes {
+		f := repov1alpha1.DryRunFile{Path: ch.Path, Change: ch.Action}
+		switch ch.Action {
+		case git.ChangeAdded:
+			st.Added++
+		case git.ChangeDeleted:
+			st.Deleted++
+		default:
+			st.Modified++
+			if ch.FromMode != ch.ToMode {
+				st.ModeChanged++
+				f.Mode = fmt.Sprintf("%s -> %s", strings.TrimPrefix(ch.FromMode.String(), "0"), strings.TrimPrefix(ch.ToMode.String(), "0"))
+			}
+		}
+		if len(st.Files) < maxDryRunFiles {
+			st.Files = append(st.Files, f)
+		}
+	}
+	return st
+}
+
+// truncateDiff truncates diff to at most max bytes, at a line boundary.
+func truncateDiff(diff string, max int) (string, bool) {
+	if len(diff) <= max {
+		return diff, false
+	}
+	diff = diff[:max]
+	if i := strings.LastIndexByte(diff, '\n'); i >= 0 {
+		diff = diff[:i+1]
+	}
+	return diff, true
+}
+
+// storeDryRunDiff creates or updates the configmap holding the diff, owned by the resource so that it is deleted with it.
+// An existing configmap not owned by the resource is never overwritten.
+func (e *external) storeDryRunDiff(ctx context.Context, cr *repov1alpha1.Repo, diff string) (*commonv1.Reference, error) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cr.GetName() + "-dry-run",
+			Namespace: cr.GetNamespace(),
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, e.kube, cm, func() error {
+		if cm.ResourceVersion != "" && !metav1.IsControlledBy(cm, cr) {
+			return fmt.Errorf("%w: configmap %s/%s", errDryRunConfigMapNotOwned, cm.Namespace, cm.Name)
+		}
+		cm.Data = map[string]string{dryRunDiffKey: diff}
+		return controllerutil.SetControllerReference(cr, cm, e.kube.Scheme())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &commonv1.Reference{Name: cm.Name, Namespace: cm.Namespace}, nil
+}
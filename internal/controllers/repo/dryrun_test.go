@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	"github.com/krateoplatformops/provider-runtime/pkg/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNewDryRunStatus(t *testing.T) {
+	st := newDryRunStatus([]git.FileChange{
+		{Path: "a.yaml", Action: git.ChangeAdded, ToMode: filemode.Regular},
+		{Path: "b.yaml", Action: git.ChangeModified, FromMode: filemode.Regular, ToMode: filemode.Regular},
+		{Path: "run.sh", Action: git.ChangeModified, FromMode: filemode.Regular, ToMode: filemode.Executable},
+		{Path: "old.yaml", Action: git.ChangeDeleted, FromMode: filemode.Regular},
+	})
+	assert.Equal(t, 1, st.Added)
+	assert.Equal(t, 2, st.Modified)
+	assert.Equal(t, 1, st.Deleted)
+	assert.Equal(t, 1, st.ModeChanged)
+	assert.Equal(t, []repov1alpha1.DryRunFile{
+		{Path: "a.yaml", Change: git.ChangeAdded},
+		{Path: "b.yaml", Change: git.ChangeModified},
+		{Path: "run.sh", Change: git.ChangeModified, Mode: "100644 -> 100755"},
+		{Path: "old.yaml", Change: git.ChangeDeleted},
+	}, st.Files)
+
+	changes := make([]git.FileChange, maxDryRunFiles+10)
+	for i := range changes {
+		changes[i] = git.FileChange{Path: "f", Action: git.ChangeAdded}
+	}
+	st = newDryRunStatus(changes)
+	assert.Equal(t, maxDryRunFiles+10, st.Added)
+	assert.Len(t, st.Files, maxDryRunFiles)
+}
+
+func TestTruncateDiff(t *testing.T) {
+	diff, truncated := truncateDiff("line 1\nline 2\n", 100)
+	assert.False(t, truncated)
+	assert.Equal(t, "line 1\nline 2\n", diff)
+
+	diff, truncated = truncateDiff("line 1\nline 2\n", 10)
+	assert.True(t, truncated)
+	assert.Equal(t, "line 1\n", diff)
+}
+
+func TestStoreDryRunDiff(t *testing.T) {
+	ctx := context.TODO()
+	scheme := runtime.NewScheme()
+	require.NoError(t, repov1alpha1.SchemeBuilder.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	cr := &repov1alpha1.Repo{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default", UID: "1234"},
+	}
+	kc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).Build()
+	e := &external{kube: kc}
+
+	for _, diff := range []string{"first", strings.Repeat("second\n", 3)} {
+		ref, err := e.storeDryRunDiff(ctx, cr, diff)
+		require.NoError(t, err)
+		assert.Equal(t, "sample-dry-run", ref.Name)
+		assert.Equal(t, "default", ref.Namespace)
+
+		cm := &corev1.ConfigMap{}
+		require.NoError(t, kc.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, cm))
+		assert.Equal(t, diff, cm.Data[dryRunDiffKey])
+		require.Len(t, cm.OwnerReferences, 1)
+		assert.Equal(t, cr.Name, cm.OwnerReferences[0].Name)
+	}
+
+	// a configmap of the user with the same name is left untouched
+	other := &repov1alpha1.Repo{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", UID: "5678"},
+	}
+	userCm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "other-dry-run", Namespace: "default"},
+		Data:       map[string]string{"settings": "user data"},
+	}
+	kc = fake.NewClientBuilder().WithScheme(scheme).WithObjects(other, userCm).Build()
+	e = &external{kube: kc}
+
+	_, err := e.storeDryRunDiff(ctx, other, "diff")
+	require.ErrorIs(t, err, errDryRunConfigMapNotOwned)
+
+	cm := &corev1.ConfigMap{}
+	require.NoError(t, kc.Get(ctx, types.NamespacedName{Name: "other-dry-run", Namespace: "default"}, cm))
+	assert.Equal(t, map[string]string{"settings": "user data"}, cm.Data)
+	assert.Empty(t, cm.OwnerReferences)
+}
+
+func TestUpdateDryRunManagementPolicy(t *testing.T) {
+	cr := &repov1alpha1.Repo{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "sample",
+			Namespace:   "default",
+			Annotations: map[string]string{meta.AnnotationKeyManagementPolicy: meta.ManagementPolicyObserve},
+		},
+		Spec: repov1alpha1.RepoSpec{DryRun: true},
+	}
+	// the dry run is not performed: the repos would be cloned with the nil client options
+	e := &external{log: logging.NewNopLogger()}
+	require.NoError(t, e.Update(context.TODO(), cr))
+	assert.Nil(t, cr.Status.DryRun)
+}
@@ -0,0 +1,125 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"sigs.k8s.io/yaml"
+)
+
+// goTemplateExcludedFuncs are the sprig functions not available to templates:
+//   - env, expandenv and getHostByName give access to the provider environment and network
+//   - random and time based functions would produce a different output (and a new commit) at each synchronization
+var goTemplateExcludedFuncs = []string{
+	"env", "expandenv", "getHostByName",
+	"now", "randAlphaNum", "randAlpha", "randAscii", "randNumeric", "randBytes", "randInt", "uuidv4",
+	"genPrivateKey", "derivePassword", "buildCustomCert",
+	"genCA", "genCAWithKey", "genSelfSignedCert", "genSelfSignedCertWithKey", "genSignedCert", "genSignedCertWithKey",
+}
+
+// goTemplateFuncMap returns the curated function library available to `gotemplate` templates.
+func goTemplateFuncMap() template.FuncMap {
+	fm := sprig.TxtFuncMap()
+	for _, name := range goTemplateExcludedFuncs {
+		delete(fm, name)
+	}
+
+	fm["toYaml"] = toYaml
+	fm["fromYaml"] = fromYaml
+	fm["required"] = required
+
+	return fm
+}
+
+// renderGoTemplate renders text, if strict is true missing values are reported as a missingVariablesError.
+// Empty delimiters are the default `{{` and `}}`. The partials are defined as named templates, usable with
+// `template` and `include`, and always use the default delimiters so that they can be shared by files with different ones.
+func renderGoTemplate(name, text string, values interface{}, strict bool, delims [2]string, partials map[string]string, out io.Writer) error {
+	tmpl := template.New(name).Delims(delims[0], delims[1]).Funcs(goTemplateFuncMap())
+	// like helm, include renders a named template so that its output can be piped
+	tmpl = tmpl.Funcs(template.FuncMap{
+		"include": func(name string, data interface{}) (string, error) {
+			var b strings.Builder
+			if err := tmpl.ExecuteTemplate(&b, name, data); err != nil {
+				return "", err
+			}
+			return b.String(), nil
+		},
+	})
+	if strict {
+		tmpl = tmpl.Option("missingkey=error").Funcs(template.FuncMap{
+			goTemplateMissingFunc: func() interface{} { return nil },
+		})
+	}
+	for partial, content := range partials {
+		if _, err := tmpl.New(partial).Delims("", "").Parse(content); err != nil {
+			return fmt.Errorf("invalid partial %s: %w", partial, err)
+		}
+	}
+	tmpl, err := tmpl.Parse(text)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	err = tmpl.Execute(&b, values)
+	if strict {
+		// execution stops at the first missing key: the node is skipped and the template executed again, until
+		// every missing key is collected
+		var missing []missingVariable
+		for err != nil {
+			mk, ok := parseGoTemplateMissingKey(name, err)
+			if !ok {
+				break
+			}
+			mv, ok := skipMissingGoTemplateKey(tmpl, mk)
+			if !ok {
+				break
+			}
+			missing = append(missing, mv)
+
+			b.Reset()
+			err = tmpl.Execute(&b, values)
+		}
+		if len(missing) > 0 {
+			return &missingVariablesError{vars: missing}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// like helm, missing values are rendered as empty strings (as mustache does)
+	_, err = io.WriteString(out, strings.ReplaceAll(b.String(), "<no value>", ""))
+	return err
+}
+
+func toYaml(v interface{}) string {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+func fromYaml(str string) map[string]interface{} {
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(str), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+func required(msg string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return v, errors.New(msg)
+	}
+	if s, ok := v.(string); ok && s == "" {
+		return v, errors.New(msg)
+	}
+	return v, nil
+}
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateRenderFuncsGoTemplate(t *testing.T) {
+	values := map[string]interface{}{
+		"name": "krateo",
+		"port": 8080,
+		"labels": map[string]interface{}{
+			"app": "krateo",
+		},
+	}
+
+	co := &copier{}
+	createRenderFuncs(co, values, renderOpts{engine: "gotemplate"})
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "sprig functions",
+			template: `{{ .name | upper }}-{{ .missing | default "fallback" }}-{{ .name | b64enc }}`,
+			expected: "KRATEO-fallback-a3JhdGVv",
+		},
+		{
+			name:     "conditionals on comparisons",
+			template: `{{ if gt .port 1024 }}unprivileged{{ else }}privileged{{ end }}`,
+			expected: "unprivileged",
+		},
+		{
+			name:     "toYaml and indent",
+			template: "labels:\n{{ toYaml .labels | indent 2 }}",
+			expected: "labels:\n  app: krateo",
+		},
+		{
+			name:     "missing values render empty",
+			template: `[{{ .missing }}]`,
+			expected: "[]",
+		},
+		{
+			name:     "required",
+			template: `{{ required "missing is required" .missing }}`,
+			wantErr:  true,
+		},
+		{
+			name:     "env is not available",
+			template: `{{ env "HOME" }}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := co.renderFunc("/values.yaml", strings.NewReader(tt.template), &out)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out.String())
+		})
+	}
+
+	name, err := co.renderFileNames("/charts/{{ .name }}/values.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "/charts/krateo/values.yaml", name)
+}
+
+func TestCreateRenderFuncsMustacheDefault(t *testing.T) {
+	co := &copier{}
+	createRenderFuncs(co, map[string]interface{}{"name": "krateo"}, renderOpts{})
+
+	var out strings.Builder
+	require.NoError(t, co.renderFunc("/values.yaml", strings.NewReader("{{ name }}"), &out))
+	assert.Equal(t, "krateo", out.String())
+}
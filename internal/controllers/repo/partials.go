@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cbroglie/mustache"
+	"github.com/go-git/go-billy/v5"
+)
+
+// partialExtensions are the extensions that can be omitted in the partial names.
+var partialExtensions = []string{".mustache", ".tpl", ".tmpl"}
+
+// partialsProvider provides the partials stored in a directory of the origin repo, for mustache as a
+// mustache.PartialProvider and for go templates as named templates.
+type partialsProvider struct {
+	fs   billy.Filesystem
+	root string
+}
+
+var _ mustache.PartialProvider = (*partialsProvider)(nil)
+
+// newPartialsProvider returns a provider of the partials in the path directory, relative to the root of the repository.
+// It returns nil if path is empty.
+func newPartialsProvider(fs billy.Filesystem, path string) *partialsProvider {
+	if len(path) == 0 {
+		return nil
+	}
+	return &partialsProvider{fs: fs, root: filepath.Join("/", path)}
+}
+
+// Get returns the content of the partial name, or an empty string if it does not exist.
+func (p *partialsProvider) Get(name string) (string, error) {
+	if p == nil {
+		return "", nil
+	}
+
+	rel := filepath.Clean(filepath.FromSlash(strings.TrimSpace(name)))
+	if rel == "." || filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid partial name %q", name)
+	}
+
+	for _, ext := range append([]string{""}, partialExtensions...) {
+		content, err := p.read(filepath.Join(p.root, rel+ext))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return content, err
+	}
+	return "", nil
+}
+
+// All returns the content of every partial by name, the name is the slash separated path relative to the partials
+// directory without the partial extension.
+func (p *partialsProvider) All() (map[string]string, error) {
+	res := map[string]string{}
+	if p == nil {
+		return res, nil
+	}
+
+	var files []string
+	if err := loadFilesIntoArray(p.fs, p.root, &files); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return res, nil
+		}
+		return nil, fmt.Errorf("unable to list partials: %w", err)
+	}
+
+	for _, file := range files {
+		content, err := p.read(file)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(p.root, file)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.ToSlash(rel)
+		for _, ext := range partialExtensions {
+			if strings.HasSuffix(name, ext) {
+				name = strings.TrimSuffix(name, ext)
+				break
+			}
+		}
+		res[name] = content
+	}
+	return res, nil
+}
+
+// contains reports whether src is the partials directory or one of its files.
+func (p *partialsProvider) contains(src string) bool {
+	if p == nil {
+		return false
+	}
+	src = filepath.Clean(src)
+	return src == p.root || strings.HasPrefix(src, p.root+string(filepath.Separator))
+}
+
+// read returns the content of the partial at path. The filesystem follows symbolic links, so a partial is rejected if it
+// or any of its parent directories is a link, which could point outside of the origin repo.
+func (p *partialsProvider) read(path string) (string, error) {
+	for dir := path; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		fi, err := p.fs.Lstat(dir)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%w: partial %s, %s is a symbolic link", ErrPathTraversal, path, dir)
+		}
+	}
+
+	fp, err := p.fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	bin, err := io.ReadAll(fp)
+	if err != nil {
+		return "", fmt.Errorf("unable to read partial %s: %w", path, err)
+	}
+	return string(bin), nil
+}
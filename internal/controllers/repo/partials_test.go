@@ -0,0 +1,124 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartials(t *testing.T) {
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	values := map[string]interface{}{"name": "krateo", "owner": "platform"}
+
+	t.Run("mustache", func(t *testing.T) {
+		origin := newTestRepo(t, url, map[string]string{
+			"/skeleton/.partials/header.mustache":  "# Copyright {{ owner }}\n",
+			"/skeleton/.partials/licenses/apache":  "# Apache-2.0\n",
+			"/skeleton/main.yaml":                  "{{> header }}{{> licenses/apache }}name: {{ name }}\n",
+			"/skeleton/escape.yaml":                "{{> ../../etc/passwd }}",
+			"/skeleton/missing.yaml":               "{{> missing }}name: {{ name }}\n",
+			"/skeleton/nested/{{ name }}/app.yaml": "  {{> header }}",
+		})
+		target := newTestRepo(t, url, nil)
+
+		co := newCopier(origin, target, "/skeleton", "/rendered")
+		co.partials = newPartialsProvider(origin.FS(), "skeleton/.partials")
+		createRenderFuncs(co, values, renderOpts{partials: co.partials})
+
+		err := co.copyDir("/skeleton", "/rendered")
+		require.ErrorContains(t, err, `invalid partial name "../../etc/passwd"`)
+
+		require.NoError(t, origin.FS().Remove("/skeleton/escape.yaml"))
+		require.NoError(t, co.copyDir("/skeleton", "/rendered"))
+
+		assert.Equal(t, "# Copyright platform\n# Apache-2.0\nname: krateo\n", readTestFile(t, target, "/rendered/main.yaml"))
+		assert.Equal(t, "name: krateo\n", readTestFile(t, target, "/rendered/missing.yaml"))
+		assert.Equal(t, "  # Copyright platform\n", readTestFile(t, target, "/rendered/nested/krateo/app.yaml"))
+
+		_, err = target.FS().Stat("/rendered/.partials")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("gotemplate", func(t *testing.T) {
+		origin := newTestRepo(t, url, map[string]string{
+			"/.krateo/partials/header.tpl":      "# Copyright {{ .owner }}\n",
+			"/.krateo/partials/labels.tpl":      `{{ define "labels" }}app: {{ .name }}{{ end }}`,
+			"/.krateo/partials/licenses/apache": "# Apache-2.0\n",
+			"/skeleton/main.yaml":               "{{ template \"header\" . }}{{ template \"licenses/apache\" }}labels:\n{{ include \"labels\" . | indent 2 }}\n",
+			"/skeleton/chart/values.yaml":       "[[ template \"header\" . ]]name: [[ .name ]]\n",
+		})
+		target := newTestRepo(t, url, nil)
+
+		co := newCopier(origin, target, "/skeleton", "/rendered")
+		co.partials = newPartialsProvider(origin.FS(), ".krateo/partials")
+		createRenderFuncs(co, values, renderOpts{
+			engine:     "gotemplate",
+			partials:   co.partials,
+			delimiters: []globDelimiters{{paths: []string{"chart/**"}, delimiters: [2]string{"[[", "]]"}}},
+		})
+
+		require.NoError(t, co.copyDir("/skeleton", "/rendered"))
+		assert.Equal(t, "# Copyright platform\n# Apache-2.0\nlabels:\n  app: krateo\n", readTestFile(t, target, "/rendered/main.yaml"))
+		// partials use the default delimiters whatever the delimiters of the including file
+		assert.Equal(t, "# Copyright platform\nname: krateo\n", readTestFile(t, target, "/rendered/chart/values.yaml"))
+	})
+
+	t.Run("symbolic links", func(t *testing.T) {
+		// a link to a file outside of the origin repo, as the service account token of the provider
+		outside := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(outside, []byte("s3cr3t"), 0600))
+
+		tests := []struct {
+			name    string
+			links   map[string]string
+			partial string
+		}{
+			{
+				name:    "file",
+				links:   map[string]string{"/.krateo/partials/token": "../../../../../../../../../.." + outside},
+				partial: "token",
+			},
+			{
+				name:    "directory",
+				links:   map[string]string{"/.krateo/partials/secrets": "../../../../../../../../../.." + filepath.Dir(outside)},
+				partial: "secrets/token",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				repo := newTestRepoWithLinks(t, url, map[string]string{"/.krateo/partials/header": "# header\n"}, tt.links)
+				p := newPartialsProvider(repo.FS(), ".krateo/partials")
+
+				content, err := p.Get("header")
+				require.NoError(t, err)
+				assert.Equal(t, "# header\n", content)
+
+				content, err = p.Get(tt.partial)
+				assert.ErrorIs(t, err, ErrPathTraversal)
+				assert.Empty(t, content)
+
+				all, err := p.All()
+				assert.ErrorIs(t, err, ErrPathTraversal)
+				assert.Nil(t, all)
+			})
+		}
+	})
+
+	t.Run("no partials directory", func(t *testing.T) {
+		p := newPartialsProvider(newTestRepo(t, url, nil).FS(), ".krateo/partials")
+		content, err := p.Get("header")
+		require.NoError(t, err)
+		assert.Empty(t, content)
+
+		all, err := p.All()
+		require.NoError(t, err)
+		assert.Empty(t, all)
+	})
+}
@@ -2,10 +2,10 @@ package repo
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -25,6 +25,7 @@ import (
 	"github.com/krateoplatformops/plumbing/ptr"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -34,10 +35,11 @@ const (
 // An ExternalClient observes, then either creates, updates, or deletes an
 // external resource to ensure it reflects the managed resource's desired state.
 type external struct {
-	kube client.Client
-	log  logging.Logger
-	cfg  *externalClientOpts
-	rec  record.EventRecorder
+	kube        client.Client
+	log         logging.Logger
+	cfg         *externalClientOpts
+	rec         record.EventRecorder
+	pushRetries int
 }
 
 var homeDir string
@@ -49,6 +51,43 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler
 	}
 	e.log.Info("Observing resource")
 
+	if isPaused(cr) {
+		e.log.Debug("Synchronization paused by annotation, skip observing.", "annotation", annotationPaused)
+		// nothing to clean up on the git servers, the resource can be deleted while paused
+		return reconciler.ExternalObservation{
+			ResourceExists:   cr.DeletionTimestamp.IsZero(),
+			ResourceUpToDate: true,
+		}, nil
+	}
+
+	obs, err := e.observe(ctx, cr)
+	if err == nil && obs.ResourceExists && pendingSyncRequest(cr) != "" {
+		e.log.Info("Synchronization requested by annotation", "annotation", annotationSyncRequestedAt, "value", pendingSyncRequest(cr))
+		obs.ResourceUpToDate = false
+	}
+	if err == nil && obs.ResourceUpToDate {
+		cr.Status.ObservedGeneration = cr.Generation
+		cr.Status.NextSyncTime = nil
+	}
+	if err != nil || !obs.ResourceExists || obs.ResourceUpToDate || cr.Spec.DryRun {
+		return obs, err
+	}
+
+	// the target repo is outdated, the update is deferred if the schedule or the sync windows do not allow it
+	deferred, err := e.deferSync(cr, time.Now())
+	if err != nil {
+		return reconciler.ExternalObservation{}, err
+	}
+	if deferred {
+		return reconciler.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: true,
+		}, nil
+	}
+	return obs, nil
+}
+
+func (e *external) observe(ctx context.Context, cr *repov1alpha1.Repo) (reconciler.ExternalObservation, error) {
 	if cr.GetCondition(commonv1.TypeReady).Reason == commonv1.ReasonDeleting {
 		return reconciler.ExternalObservation{
 			ResourceExists:   false,
@@ -67,8 +106,17 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler
 		}
 	}
 
+	if cr.Spec.DryRun {
+		return e.observeDryRun(ctx, cr)
+	}
+
 	if !cr.Spec.EnableUpdate && cr.Status.TargetCommitId != "" && cr.Status.OriginCommitId != "" && cr.Status.TargetBranch != "" && cr.Status.OriginBranch != "" {
 		e.log.Debug("External resource should not be observed by provider, skip observing. EnableUpdate is false.", "name", cr.Name)
+		if cr.Spec.DriftDetection == driftDetectionContent {
+			if _, err := e.observeContent(ctx, cr); err != nil {
+				return reconciler.ExternalObservation{}, err
+			}
+		}
 		cr.Status.SetConditions(commonv1.Available())
 		return reconciler.ExternalObservation{
 			ResourceExists:   true,
@@ -86,6 +134,18 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler
 			ResourceUpToDate: true,
 		}, nil
 	}
+
+	values, err := e.loadValues(ctx, &cr.Spec)
+	if err != nil {
+		e.log.Debug("Unable to load template values", "msg", err.Error())
+	} else if hash, err := valuesHash(values); err == nil && hash != cr.Status.ValuesHash {
+		e.log.Debug("Template values changed", "valuesHash", hash, "lastValuesHash", cr.Status.ValuesHash)
+		return reconciler.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: false,
+		}, nil
+	}
+
 	latestCommit, err := git.GetLatestCommitRemote(git.ListOptions{
 		URL:        cr.Spec.FromRepo.Url,
 		Auth:       e.cfg.FromRepoCreds,
@@ -129,6 +189,19 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler
 		}, nil
 	}
 
+	if cr.Spec.DriftDetection == driftDetectionContent {
+		reapply, err := e.observeContent(ctx, cr)
+		if err != nil {
+			return reconciler.ExternalObservation{}, err
+		}
+		if reapply {
+			return reconciler.ExternalObservation{
+				ResourceExists:   true,
+				ResourceUpToDate: false,
+			}, nil
+		}
+	}
+
 	cr.Status.SetConditions(commonv1.Available())
 
 	return reconciler.ExternalObservation{
@@ -157,14 +230,24 @@ func (e *external) Update(ctx context.Context, mg resource.Managed) error {
 		return errors.New(errNotRepo)
 	}
 
-	if !cr.Spec.EnableUpdate {
+	if !meta.IsActionAllowed(cr, meta.ActionUpdate) {
 		e.log.Debug("External resource should not be updated by provider, skip updating.")
 		return nil
 	}
-	if !meta.IsActionAllowed(cr, meta.ActionUpdate) {
+
+	if cr.Spec.DryRun {
+		e.log.Info("Performing dry run")
+		return e.SyncRepos(ctx, cr, "dry run")
+	}
+
+	// a sync request is an explicit update, performed regardless of enableUpdate
+	if !cr.Spec.EnableUpdate && pendingSyncRequest(cr) == "" {
 		e.log.Debug("External resource should not be updated by provider, skip updating.")
 		return nil
 	}
+	if deferred, err := e.deferSync(cr, time.Now()); err != nil || deferred {
+		return err
+	}
 
 	e.log.Info("Updating resource")
 	cr.Status.SetConditions(commonv1.Creating())
@@ -197,10 +280,7 @@ func (e *external) loadValuesFromConfigMap(ctx context.Context, ref *commonv1.Co
 		return nil, err
 	}
 
-	js = strings.TrimPrefix(js, "'")
-	js = strings.TrimSuffix(js, "'")
-
-	err = json.Unmarshal([]byte(js), &res)
+	res, err = parseValues(js)
 	if err != nil {
 		e.log.Debug(err.Error(), "json", js)
 		return nil, err
@@ -209,31 +289,158 @@ func (e *external) loadValuesFromConfigMap(ctx context.Context, ref *commonv1.Co
 	return res, nil
 }
 
-func (e *external) SyncRepos(ctx context.Context, cr *repov1alpha1.Repo, commitMessage string) error {
+func (e *external) loadTrustedKeyring(ctx context.Context, opts *repov1alpha1.VerifySignaturesOpts) (*git.Keyring, error) {
+	var keys []string
 
-	spec := cr.Spec.DeepCopy()
+	if opts.KeyringConfigMapRef != nil {
+		val, err := resource.GetConfigMapValue(ctx, e.kube, opts.KeyringConfigMapRef)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, val)
+	}
 
-	toRepo, err := git.Clone(git.CloneOptions{
+	if opts.KeyringSecretRef != nil {
+		val, err := resource.GetSecret(ctx, e.kube, opts.KeyringSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, val)
+	}
+
+	return git.NewKeyring(strings.Join(keys, "\n"))
+}
+
+// verifyOriginSignatures refuses to synchronize origin commits not signed by a trusted key.
+func (e *external) verifyOriginSignatures(ctx context.Context, cr *repov1alpha1.Repo, fromRepo *git.Repo, opts *repov1alpha1.VerifySignaturesOpts) error {
+	kr, err := e.loadTrustedKeyring(ctx, opts)
+	if err != nil {
+		cr.SetConditions(repov1alpha1.SignaturesNotTrusted(repov1alpha1.ReasonInvalidKeyring, err))
+		e.rec.Eventf(cr, corev1.EventTypeWarning, string(repov1alpha1.ReasonInvalidKeyring),
+			"Unable to load trusted keyring: %s", err.Error())
+		return fmt.Errorf("unable to load trusted keyring: %w", err)
+	}
+
+	since := ""
+	if strings.EqualFold(opts.Mode, "all") {
+		since = cr.Status.OriginCommitId
+	}
+
+	rewritten := false
+	if since != "" {
+		ok, err := fromRepo.InHistory(since)
+		if err != nil {
+			return fmt.Errorf("unable to look up commit %s in origin history: %w", since, err)
+		}
+		if !ok {
+			// after a force-push the whole history would be verified, back to the root commit
+			rewritten = true
+			e.log.Info("Last synchronized commit not in origin history, verifying only the tip commit", "since", since)
+			e.rec.Eventf(cr, corev1.EventTypeWarning, string(repov1alpha1.ReasonHistoryRewritten),
+				"Commit %s is not in the origin history, verifying only the tip commit", since)
+			since = ""
+		}
+	}
+
+	if err := fromRepo.VerifyCommits(kr, since); err != nil {
+		reason := repov1alpha1.ReasonUntrustedSignature
+		if errors.Is(err, git.ErrCommitNotSigned) {
+			reason = repov1alpha1.ReasonUnsignedCommit
+		}
+		cr.SetConditions(repov1alpha1.SignaturesNotTrusted(reason, err))
+		e.log.Info("Refusing to synchronize origin repo", "reason", reason, "msg", err.Error())
+		e.rec.Eventf(cr, corev1.EventTypeWarning, string(reason),
+			"Refusing to synchronize origin repo: %s", err.Error())
+		return fmt.Errorf("unable to verify origin commit signatures: %w", err)
+	}
+
+	if rewritten {
+		cr.SetConditions(repov1alpha1.SignaturesTrustedAtTip(cr.Status.OriginCommitId))
+	} else {
+		cr.SetConditions(repov1alpha1.SignaturesTrusted())
+	}
+	e.log.Debug("Origin commit signatures verified", "mode", opts.Mode, "since", since)
+	e.rec.Eventf(cr, corev1.EventTypeNormal, "OriginSignaturesVerified",
+		"Origin commits are signed by trusted keys")
+	return nil
+}
+
+// validateValues validates the template values against the schema shipped in the origin repo, if any, and returns them with the schema defaults applied.
+func (e *external) validateValues(spec *repov1alpha1.RepoSpec, fromRepo *git.Repo, values map[string]interface{}, rep *renderReport) (map[string]interface{}, error) {
+	schema, err := loadValuesSchema(fromRepo, spec.FromRepo.ValuesSchemaPath)
+	if err == nil && schema == nil {
+		e.log.Debug("Template values schema not found, skipping validation", "path", spec.FromRepo.ValuesSchemaPath)
+		return values, nil
+	}
+	if err == nil {
+		values, err = schema.Validate(values)
+	}
+	if err != nil {
+		reason := repov1alpha1.ReasonValuesInvalid
+		if !errors.Is(err, ErrValuesInvalid) {
+			reason = repov1alpha1.ReasonInvalidSchema
+		}
+		rep.conditions = append(rep.conditions, repov1alpha1.ValuesInvalid(reason, err))
+		rep.warn(string(reason), "Template values validation failed: %s", err.Error())
+		return nil, fmt.Errorf("unable to validate template values: %w", err)
+	}
+
+	rep.conditions = append(rep.conditions, repov1alpha1.ValuesValid())
+	return values, nil
+}
+
+// copyToTarget copies the origin files into the target worktree.
+// If override is false, the files already existing in the target path are left untouched.
+func (e *external) copyToTarget(co *copier, override bool, fromPath, toPath string) error {
+	if err := checkTargetPath(toPath); err != nil {
+		return fmt.Errorf("invalid target path: %w", err)
+	}
+
+	co.targetIgnore = nil
+	if !override {
+		e.log.Debug("Override is false, ignoring files that already exist in target repo")
+		if _, err := co.toRepo.FS().Stat(toPath); err == nil {
+			err = loadIgnoreTargetFiles(toPath, co)
+			if err != nil {
+				return fmt.Errorf("unable to load ignore target files: %w", err)
+			}
+		} else if os.IsNotExist(err) {
+			e.log.Debug("Target path does not exist, no files to ignore", "path", toPath)
+		} else {
+			return fmt.Errorf("unable to check target path: %w", err)
+		}
+	}
+
+	co.missing = nil
+	co.protectedSkipped = nil
+	co.modes = nil
+	if err := co.copyDir(fromPath, toPath); err != nil {
+		return fmt.Errorf("unable to copy files: %w", err)
+	}
+	if len(co.missing) > 0 {
+		return &missingVariablesError{vars: co.missing}
+	}
+	return nil
+}
+
+// cloneTarget clones the branch of the target repo, or the branch it is created from if it does not exist yet.
+func (e *external) cloneTarget(spec *repov1alpha1.RepoSpec) (*git.Repo, error) {
+	return git.Clone(git.CloneOptions{
 		URL:                     spec.ToRepo.Url,
 		Auth:                    e.cfg.ToRepoCreds,
 		Insecure:                e.cfg.Insecure,
 		UnsupportedCapabilities: e.cfg.UnsupportedCapabilities,
 		Branch:                  spec.ToRepo.Branch,
-		AlternativeBranch:       ptr.To(cr.Spec.ToRepo.CloneFromBranch),
+		AlternativeBranch:       ptr.To(spec.ToRepo.CloneFromBranch),
 		GitCookies:              e.cfg.ToRepoCookieFile,
 		HomeDir:                 homeDir, // Use the configured home directory for temporary files
+		Signer:                  e.cfg.ToRepoSigner,
 	})
-	if err != nil {
-		return fmt.Errorf("cloning toRepo: %w", err)
-	}
-	defer toRepo.Cleanup()
-
-	e.log.Debug("Target repo cloned", "url", spec.ToRepo.Url)
-	e.rec.Eventf(cr, corev1.EventTypeNormal, "TargetRepoCloned",
-		"Successfully cloned target repo: %s", spec.ToRepo.Url)
-	e.log.Debug(fmt.Sprintf("Target repo on branch %s", toRepo.CurrentBranch()))
+}
 
-	fromRepo, err := git.Clone(git.CloneOptions{
+// cloneOrigin clones the branch of the origin repo.
+func (e *external) cloneOrigin(spec *repov1alpha1.RepoSpec) (*git.Repo, error) {
+	return git.Clone(git.CloneOptions{
 		URL:                     spec.FromRepo.Url,
 		Auth:                    e.cfg.FromRepoCreds,
 		Insecure:                e.cfg.Insecure,
@@ -242,21 +449,62 @@ func (e *external) SyncRepos(ctx context.Context, cr *repov1alpha1.Repo, commitM
 		GitCookies:              e.cfg.FromRepoCookieFile,
 		HomeDir:                 homeDir, // Use the configured home directory for temporary files
 	})
-	if err != nil {
-		return fmt.Errorf("cloning fromRepo: %w", err)
-	}
-	defer fromRepo.Cleanup()
-	e.log.Debug("Origin repo cloned", "url", spec.FromRepo.Url)
-	e.rec.Eventf(cr, corev1.EventTypeNormal, "OriginRepoCloned",
-		"Successfully cloned origin repo: %s", spec.FromRepo.Url)
-	e.log.Debug(fmt.Sprintf("Origin repo on branch %s", fromRepo.CurrentBranch()))
+}
 
-	fromRepoCommitId, err := fromRepo.GetLatestCommit(fromRepo.CurrentBranch())
-	if err != nil {
-		return err
+// rendering is the origin repo rendered into the worktree of the target repo.
+type rendering struct {
+	co         *copier
+	fromPath   string
+	toPath     string
+	valuesHash string
+}
+
+// renderReport collects the events and conditions of a render, so that rendering has no side effects on the Repo:
+// SyncRepos applies them, drift detection (which renders at every poll) discards them.
+type renderReport struct {
+	events     []renderEvent
+	conditions []commonv1.Condition
+}
+
+type renderEvent struct {
+	reason  string
+	message string
+}
+
+// warn records a Warning event.
+func (rep *renderReport) warn(reason, format string, args ...interface{}) {
+	rep.events = append(rep.events, renderEvent{reason: reason, message: fmt.Sprintf(format, args...)})
+}
+
+// apply logs and emits the events and sets the conditions of the report on cr.
+func (rep *renderReport) apply(e *external, cr *repov1alpha1.Repo) {
+	cr.SetConditions(rep.conditions...)
+	for _, ev := range rep.events {
+		e.log.Info(ev.message, "reason", ev.reason)
+		e.rec.Event(cr, corev1.EventTypeWarning, ev.reason, ev.message)
 	}
+}
+
+// render copies and renders the files of fromRepo into the worktree of toRepo, following the spec, and applies the
+// events and conditions of the render to cr.
+// If override is false, the files already existing in the target path are left untouched.
+func (e *external) render(ctx context.Context, cr *repov1alpha1.Repo, spec *repov1alpha1.RepoSpec, fromRepo, toRepo *git.Repo, override bool) (*rendering, error) {
+	rep := &renderReport{}
+	r, err := e.renderTarget(ctx, spec, fromRepo, toRepo, override, rep)
+	rep.apply(e, cr)
+	return r, err
+}
 
+// renderTarget is render without side effects: the events and conditions are collected in rep.
+func (e *external) renderTarget(ctx context.Context, spec *repov1alpha1.RepoSpec, fromRepo, toRepo *git.Repo, override bool, rep *renderReport) (*rendering, error) {
 	co := newCopier(fromRepo, toRepo, spec.FromRepo.Path, spec.ToRepo.Path)
+	co.log = e.log
+	co.protected = compileProtectedPaths(spec.ToRepo.ProtectedPaths)
+	co.symlinks = spec.Symlinks
+	co.controlFiles = controlFiles(spec.FromRepo.ValuesSchemaPath, spec.FromRepo.RulesPath)
+	if spec.PathTemplating != nil {
+		co.skipEmptyNames = spec.PathTemplating.SkipEmpty
+	}
 
 	// If fromPath is not specified DON'T COPY!
 	fromPath := spec.FromRepo.Path
@@ -267,62 +515,141 @@ func (e *external) SyncRepos(ctx context.Context, cr *repov1alpha1.Repo, commitM
 	if len(fromPath) == 0 {
 		fromPath = "/"
 	}
+	var effectiveValuesHash string
 	if len(fromPath) > 0 {
-		var values map[string]interface{}
-		if spec.ConfigMapKeyRef != nil {
-			values, err = e.loadValuesFromConfigMap(ctx, spec.ConfigMapKeyRef)
-			if err != nil {
-				e.log.Debug("Unable to load configmap with template data", "msg", err.Error())
-				e.rec.Eventf(cr, corev1.EventTypeWarning, "CannotLoadConfigMap",
-					"Unable to load configmap with template data: %s", err.Error())
-			}
+		values, err := e.loadValues(ctx, spec)
+		if err != nil {
+			rep.warn("CannotLoadValues", "Unable to load template values: %s", err.Error())
+		}
+		e.log.Debug("Loaded template values", "values", values)
 
-			e.log.Debug("Loaded values from config map",
-				"name", spec.ConfigMapKeyRef.Name,
-				"key", spec.ConfigMapKeyRef.Key,
-				"namespace", spec.ConfigMapKeyRef.Namespace,
-				"values", values,
-			)
-		}
-
-		if !cr.Spec.Override {
-			e.log.Debug("Override is false, ignoring files that already exist in target repo")
-			if _, err := toRepo.FS().Stat(toPath); err == nil {
-				err = loadIgnoreTargetFiles(toPath, co)
-				if err != nil {
-					return fmt.Errorf("unable to load ignore target files: %w", err)
-				}
-			} else if os.IsNotExist(err) {
-				e.log.Debug("Target path does not exist, no files to ignore", "path", toPath)
-			} else {
-				return fmt.Errorf("unable to check target path: %w", err)
-			}
-		} else {
-			co.targetIgnore = nil
+		effectiveValuesHash, err = valuesHash(values)
+		if err != nil {
+			return nil, fmt.Errorf("unable to compute template values hash: %w", err)
+		}
+
+		values, err = e.validateValues(spec, fromRepo, values, rep)
+		if err != nil {
+			return nil, err
+		}
+
+		if spec.Override {
 			e.log.Debug("Override is true, overriding all files in target repo")
 			if co.originCopyPath == "/" && co.targetCopyPath == "/" {
-				e.rec.Eventf(cr, corev1.EventTypeWarning, "OverrideWarning",
+				rep.warn("OverrideWarning",
 					"Override is set to true, but originPath and targetPath are both set to '/', this will override also service folders like .git, .github, .gitignore, etc. Consider using a different path for originPath or targetPath. This can broke the target repository causing the impossibility to push changes.")
-				e.log.Info("Override is set to true, but originPath and targetPath are both set to '/', this will override also service folders like .git, .github, .gitignore, etc. Consider using a different path for originPath or targetPath. This can broke the target repository causing the impossibility to push changes.")
 			}
 		}
 
-		ignorePath := cr.Spec.FromRepo.KrateoIgnorePath
+		ignorePath := spec.FromRepo.KrateoIgnorePath
 		if err := loadIgnoreFileEventually(co, ignorePath); err != nil {
-			e.log.Info("Unable to load '.krateoignore'", "msg", err.Error())
-			e.rec.Eventf(cr, corev1.EventTypeWarning, "CannotLoadIgnoreFile",
-				"Unable to load '.krateoignore' file: %s", err.Error())
+			rep.warn("CannotLoadIgnoreFile", "Unable to load '.krateoignore' file: %s", err.Error())
+		}
+
+		co.rules, err = loadRules(fromRepo, spec.FromRepo.RulesPath, values)
+		if err != nil {
+			rep.warn("InvalidRules", "Unable to load rules: %s", err.Error())
+			return nil, fmt.Errorf("unable to load rules: %w", err)
+		}
+
+		if err := loadGitAttributesEventually(co); err != nil {
+			rep.warn("CannotLoadGitAttributes", "Unable to load '.gitattributes' files: %s", err.Error())
 		}
 
-		if values != nil {
-			createRenderFuncs(co, values)
+		// in strict mode templates are checked even without values, so that every variable is reported as missing
+		co.partials = newPartialsProvider(fromRepo.FS(), spec.FromRepo.PartialsPath)
+		if values != nil || spec.StrictTemplating {
+			opts := newRenderOpts(spec)
+			opts.partials = co.partials
+			createRenderFuncs(co, values, opts)
+		}
+
+		if isSquash(spec.ToRepo) {
+			e.log.Debug("History mode is squash, replacing target branch with an orphan commit", "branch", toRepo.CurrentBranch())
+			if err := toRepo.Orphan(func(path string) bool { return co.isProtected(path) }); err != nil {
+				return nil, fmt.Errorf("unable to create orphan branch on target repo: %w", err)
+			}
+		}
+
+		if err := e.copyToTarget(co, override, fromPath, toPath); err != nil {
+			if errors.Is(err, ErrPathTraversal) {
+				rep.warn("PathTraversalBlocked",
+					"Security: refusing to write outside the target path or into .git, check the template values and the file names of the origin repo: %s", err.Error())
+			}
+			return nil, err
+		}
+		for _, path := range co.protectedSkipped {
+			rep.warn("ProtectedPathSkipped", "Protected path %s of the target repo not written", path)
 		}
+	}
+
+	return &rendering{co: co, fromPath: fromPath, toPath: toPath, valuesHash: effectiveValuesHash}, nil
+}
+
+// persistFailure updates the status of cr, holding the conditions that explain err, and returns err. The conditions
+// would be lost otherwise when the first synchronization fails, since the reconciler discards the status of a failed Create.
+func (e *external) persistFailure(ctx context.Context, cr *repov1alpha1.Repo, err error) error {
+	if uerr := e.kube.Status().Update(ctx, cr); uerr != nil {
+		e.log.Debug("Unable to update status", "msg", uerr.Error())
+	}
+	return err
+}
+
+func (e *external) SyncRepos(ctx context.Context, cr *repov1alpha1.Repo, commitMessage string) error {
+
+	spec := cr.Spec.DeepCopy()
+
+	start := time.Now()
+	cr.Status.LastAttemptTime = &metav1.Time{Time: start}
+
+	toRepo, err := e.cloneTarget(spec)
+	if err != nil {
+		return fmt.Errorf("cloning toRepo: %w", err)
+	}
+	defer toRepo.Cleanup()
+
+	e.log.Debug("Target repo cloned", "url", spec.ToRepo.Url)
+	e.rec.Eventf(cr, corev1.EventTypeNormal, "TargetRepoCloned",
+		"Successfully cloned target repo: %s", spec.ToRepo.Url)
+	e.log.Debug(fmt.Sprintf("Target repo on branch %s", toRepo.CurrentBranch()))
+
+	fromRepo, err := e.cloneOrigin(spec)
+	if err != nil {
+		return fmt.Errorf("cloning fromRepo: %w", err)
+	}
+	defer fromRepo.Cleanup()
+	e.log.Debug("Origin repo cloned", "url", spec.FromRepo.Url)
+	e.rec.Eventf(cr, corev1.EventTypeNormal, "OriginRepoCloned",
+		"Successfully cloned origin repo: %s", spec.FromRepo.Url)
+	e.log.Debug(fmt.Sprintf("Origin repo on branch %s", fromRepo.CurrentBranch()))
+
+	fromRepoCommitId, err := fromRepo.GetLatestCommit(fromRepo.CurrentBranch())
+	if err != nil {
+		return err
+	}
+	fromRepoRef, err := fromRepo.HeadRef()
+	if err != nil {
+		return err
+	}
 
-		if err := co.copyDir(fromPath, toPath); err != nil {
-			return fmt.Errorf("unable to copy files: %w", err)
+	// the tip of the target branch before any change, the base of the dry run diff (empty for a new branch)
+	targetCommitId, _ := toRepo.GetLatestCommit(toRepo.CurrentBranch())
+	durations := repov1alpha1.SyncDurations{Clone: metav1.Duration{Duration: time.Since(start)}}
+
+	if spec.FromRepo.VerifySignatures != nil {
+		if err := e.verifyOriginSignatures(ctx, cr, fromRepo, spec.FromRepo.VerifySignatures); err != nil {
+			return e.persistFailure(ctx, cr, err)
 		}
 	}
 
+	renderStart := time.Now()
+	r, err := e.render(ctx, cr, spec, fromRepo, toRepo, cr.Spec.Override)
+	if err != nil {
+		return e.persistFailure(ctx, cr, err)
+	}
+	durations.Render = metav1.Duration{Duration: time.Since(renderStart)}
+	co, fromPath, toPath, effectiveValuesHash := r.co, r.fromPath, r.toPath, r.valuesHash
+
 	e.log.Info("Origin and target repo synchronized",
 		"fromUrl", spec.FromRepo.Url,
 		"toUrl", spec.ToRepo.Url,
@@ -331,54 +658,124 @@ func (e *external) SyncRepos(ctx context.Context, cr *repov1alpha1.Repo, commitM
 	e.rec.Eventf(cr, corev1.EventTypeNormal, "RepoSyncSuccess",
 		"Origin and target repo synchronized")
 
-	toRepoCommitId, err := toRepo.Commit(".", commitMessage, &git.IndexOptions{
-		OriginRepo: fromRepo,
-		FromPath:   fromPath,
-		ToPath:     toPath,
-	})
-	if err == git.NoErrAlreadyUpToDate {
-		toRepoCommitId, err := toRepo.GetLatestCommit(toRepo.CurrentBranch())
-		if err != nil {
-			return fmt.Errorf("unable to get latest commit from target repo: %w", err)
-		}
-		e.log.Info("Target repo not commited", "branch", toRepo.CurrentBranch(), "status", "repository already up-to-date")
-		e.rec.Eventf(cr, corev1.EventTypeNormal, "RepoAlreadyUpToDate",
-			fmt.Sprintf("Target repo already up-to-date on branch %s", toRepo.CurrentBranch()))
+	if spec.DryRun {
+		return e.dryRun(ctx, cr, toRepo, &git.IndexOptions{
+			OriginRepo: fromRepo,
+			FromPath:   fromPath,
+			ToPath:     toPath,
+			Modes:      co.modes,
+		}, targetCommitId, fromRepoCommitId, effectiveValuesHash)
+	}
 
+	updateSyncedStatus := func(toRepoCommitId string) error {
 		meta.SetExternalName(cr, toRepoCommitId)
 		cr.Status.OriginCommitId = fromRepoCommitId
 		cr.Status.TargetCommitId = toRepoCommitId
 		cr.Status.TargetBranch = toRepo.CurrentBranch()
 		cr.Status.OriginBranch = fromRepo.CurrentBranch()
-
-		err = e.kube.Status().Update(ctx, cr)
-		if err != nil {
+		cr.Status.OriginRef = fromRepoRef
+		cr.Status.ValuesHash = effectiveValuesHash
+		cr.Status.ObservedGeneration = cr.Generation
+		cr.Status.DryRun = nil
+		cr.Status.LastSyncTime = ptr.To(metav1.Now())
+		cr.Status.NextSyncTime = nil
+		cr.Status.LastHandledSyncRequest = cr.GetAnnotations()[annotationSyncRequestedAt]
+		cr.Status.Durations = &durations
+
+		if err := e.kube.Status().Update(ctx, cr); err != nil {
 			return fmt.Errorf("unable to update status: %w", err)
 		}
 		return nil
-	} else if err != nil {
-		return fmt.Errorf("unable to commit target repo: %w", err)
 	}
-	e.log.Info("Target repo committed", "branch", toRepo.CurrentBranch(), "commitId", toRepoCommitId)
-	e.rec.Eventf(cr, corev1.EventTypeNormal, "RepoCommitSuccess",
-		fmt.Sprintf("Target repo committed on branch %s", toRepo.CurrentBranch()))
 
-	err = toRepo.Push("origin", toRepo.CurrentBranch(), e.cfg.Insecure)
-	if err != nil {
-		return fmt.Errorf("unable to push target repo: %w", err)
+	pushStart := time.Now()
+	var toRepoCommitId string
+	for attempt := 1; ; attempt++ {
+		toRepoCommitId, err = toRepo.Commit(".", commitMessage, &git.IndexOptions{
+			OriginRepo: fromRepo,
+			FromPath:   fromPath,
+			ToPath:     toPath,
+			Modes:      co.modes,
+		})
+		if err == git.NoErrAlreadyUpToDate {
+			toRepoCommitId, err := toRepo.GetLatestCommit(toRepo.CurrentBranch())
+			if err != nil {
+				return fmt.Errorf("unable to get latest commit from target repo: %w", err)
+			}
+			e.log.Info("Target repo not commited", "branch", toRepo.CurrentBranch(), "status", "repository already up-to-date")
+			e.rec.Eventf(cr, corev1.EventTypeNormal, "RepoAlreadyUpToDate",
+				fmt.Sprintf("Target repo already up-to-date on branch %s", toRepo.CurrentBranch()))
+
+			durations.Push = metav1.Duration{Duration: time.Since(pushStart)}
+			return updateSyncedStatus(toRepoCommitId)
+		} else if err != nil {
+			return fmt.Errorf("unable to commit target repo: %w", err)
+		}
+		e.log.Info("Target repo committed", "branch", toRepo.CurrentBranch(), "commitId", toRepoCommitId)
+		e.rec.Eventf(cr, corev1.EventTypeNormal, "RepoCommitSuccess",
+			fmt.Sprintf("Target repo committed on branch %s", toRepo.CurrentBranch()))
+
+		err = toRepo.Push("origin", toRepo.CurrentBranch(), e.cfg.Insecure, pushOptFor(spec.ToRepo, cr.Status.TargetCommitId))
+		if err == nil {
+			break
+		}
+		if errors.Is(err, git.ErrStaleLease) {
+			cr.SetConditions(repov1alpha1.PushRejected(repov1alpha1.ReasonStaleLease, err))
+			e.rec.Eventf(cr, corev1.EventTypeWarning, string(repov1alpha1.ReasonStaleLease),
+				"Target branch %s does not point to %s anymore, refusing to overwrite it: %s", toRepo.CurrentBranch(), cr.Status.TargetCommitId, err.Error())
+			return fmt.Errorf("unable to push target repo: %w", err)
+		}
+		if !errors.Is(err, git.ErrNonFastForward) {
+			return fmt.Errorf("unable to push target repo: %w", err)
+		}
+		if attempt > e.pushRetries {
+			cr.SetConditions(repov1alpha1.PushRejected(repov1alpha1.ReasonPushRejected, err))
+			e.rec.Eventf(cr, corev1.EventTypeWarning, string(repov1alpha1.ReasonPushRejected),
+				"Target repo push rejected %d times, giving up: %s", attempt, err.Error())
+			return fmt.Errorf("unable to push target repo after %d attempts: %w", attempt, err)
+		}
+
+		// The target branch moved since the clone: replay the copy on the new tip and retry.
+		e.log.Info("Target repo push rejected, replaying changes on the updated branch", "branch", toRepo.CurrentBranch(), "attempt", attempt)
+		e.rec.Eventf(cr, corev1.EventTypeNormal, "RepoPushRetry",
+			"Target branch %s was updated concurrently, replaying changes (attempt %d)", toRepo.CurrentBranch(), attempt)
+
+		if err := toRepo.ResetToRemote("origin", toRepo.CurrentBranch(), e.cfg.Insecure); err != nil {
+			return fmt.Errorf("unable to reset target repo to the remote branch: %w", err)
+		}
+		targetCommitId, _ = toRepo.GetLatestCommit(toRepo.CurrentBranch())
+		if err := e.copyToTarget(co, cr.Spec.Override, fromPath, toPath); err != nil {
+			return err
+		}
 	}
+	cr.SetConditions(repov1alpha1.PushSucceeded())
 	e.log.Info("Target repo pushed", "branch", toRepo.CurrentBranch(), "commitId", toRepoCommitId)
 	e.rec.Eventf(cr, corev1.EventTypeNormal, "RepoPushSuccess",
 		fmt.Sprintf("Target repo pushed branch %s", toRepo.CurrentBranch()))
 
-	meta.SetExternalName(cr, toRepoCommitId)
-	cr.Status.OriginCommitId = fromRepoCommitId
-	cr.Status.TargetCommitId = toRepoCommitId
-	cr.Status.TargetBranch = toRepo.CurrentBranch()
-	cr.Status.OriginBranch = fromRepo.CurrentBranch()
-	err = e.kube.Status().Update(ctx, cr)
-	if err != nil {
-		return fmt.Errorf("unable to update status: %w", err)
+	durations.Push = metav1.Duration{Duration: time.Since(pushStart)}
+
+	// the changes are counted against the tip the commit replaced, which is not its parent in squash mode
+	if changes, err := toRepo.Changes(targetCommitId, toRepoCommitId); err != nil {
+		e.log.Info("Unable to count the files changed by the commit", "commitId", toRepoCommitId, "msg", err.Error())
+	} else {
+		cr.Status.LastCommit = newCommitStats(changes)
 	}
-	return nil
+	return updateSyncedStatus(toRepoCommitId)
+}
+
+// newCommitStats counts the changed files by kind of change.
+func newCommitStats(changes []git.FileChange) *repov1alpha1.CommitStats {
+	res := &repov1alpha1.CommitStats{}
+	for _, ch := range changes {
+		switch ch.Action {
+		case git.ChangeAdded:
+			res.Added++
+		case git.ChangeDeleted:
+			res.Deleted++
+		default:
+			res.Modified++
+		}
+	}
+	return res
 }
@@ -0,0 +1,193 @@
+package repo
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	commonv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNewCommitStats(t *testing.T) {
+	stats := newCommitStats([]git.FileChange{
+		{Path: "a", Action: git.ChangeAdded},
+		{Path: "b", Action: git.ChangeAdded},
+		{Path: "c", Action: git.ChangeModified},
+		{Path: "d", Action: git.ChangeDeleted},
+	})
+	assert.Equal(t, &repov1alpha1.CommitStats{Added: 2, Modified: 1, Deleted: 1}, stats)
+	assert.Equal(t, &repov1alpha1.CommitStats{}, newCommitStats(nil))
+}
+
+func TestObserveSetsObservedGeneration(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, repov1alpha1.SchemeBuilder.AddToScheme(scheme))
+
+	cr := &repov1alpha1.Repo{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default", Generation: 3},
+		Status: repov1alpha1.RepoStatus{
+			OriginCommitId: "a", TargetCommitId: "b", OriginBranch: "main", TargetBranch: "main",
+			ObservedGeneration: 2,
+			NextSyncTime:       &metav1.Time{},
+		},
+	}
+	e := &external{
+		kube: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).WithStatusSubresource(cr).Build(),
+		log:  logging.NewNopLogger(),
+		cfg:  &externalClientOpts{},
+		rec:  record.NewFakeRecorder(10),
+	}
+
+	obs, err := e.Observe(context.TODO(), cr)
+	require.NoError(t, err)
+	assert.True(t, obs.ResourceUpToDate)
+	assert.Equal(t, int64(3), cr.Status.ObservedGeneration)
+	assert.Nil(t, cr.Status.NextSyncTime)
+}
+
+func TestCreatePersistsSignaturesNotTrusted(t *testing.T) {
+	ctx := context.TODO()
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, repov1alpha1.SchemeBuilder.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	keyring := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "trusted-keys", Namespace: "default"},
+		Data:       map[string]string{"keys": string(ssh.MarshalAuthorizedKey(sshPub))},
+	}
+
+	// the commits of the basic repository are not signed
+	cr := &repov1alpha1.Repo{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default"},
+		Spec: repov1alpha1.RepoSpec{
+			FromRepo: repov1alpha1.FromRepoOpts{
+				RepoOpts: repov1alpha1.RepoOpts{Url: url, Branch: "master"},
+				VerifySignatures: &repov1alpha1.VerifySignaturesOpts{
+					Mode: "tip",
+					KeyringConfigMapRef: &commonv1.ConfigMapKeySelector{
+						Key:       "keys",
+						Reference: commonv1.Reference{Name: "trusted-keys", Namespace: "default"},
+					},
+				},
+			},
+			ToRepo: repov1alpha1.ToRepoOpts{RepoOpts: repov1alpha1.RepoOpts{Url: url, Branch: "master"}},
+		},
+	}
+	kc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cr, keyring).WithStatusSubresource(cr).Build()
+	e := &external{
+		kube: kc,
+		log:  logging.NewNopLogger(),
+		cfg:  &externalClientOpts{},
+		rec:  record.NewFakeRecorder(10),
+	}
+
+	err = e.Create(ctx, cr)
+	require.ErrorIs(t, err, git.ErrCommitNotSigned)
+
+	// the reconciler discards the in-memory status of a failed Create
+	stored := &repov1alpha1.Repo{}
+	require.NoError(t, kc.Get(ctx, types.NamespacedName{Name: "sample", Namespace: "default"}, stored))
+	cond := stored.GetCondition(repov1alpha1.TypeSignaturesVerified)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, repov1alpha1.ReasonUnsignedCommit, cond.Reason)
+}
+
+func TestCreatePersistsValuesInvalid(t *testing.T) {
+	ctx := context.TODO()
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	// the origin branch ships a schema the empty template values do not satisfy
+	origin := newTestRepo(t, url, map[string]string{
+		"/.krateo/values.schema.json": `{"type": "object", "required": ["name"]}`,
+	})
+	_, err := origin.Commit(".", "Add values schema", &git.IndexOptions{OriginRepo: origin, FromPath: "/", ToPath: "/"})
+	require.NoError(t, err)
+	require.NoError(t, origin.Push("origin", "schema", false, nil))
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, repov1alpha1.SchemeBuilder.AddToScheme(scheme))
+
+	cr := &repov1alpha1.Repo{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default"},
+		Spec: repov1alpha1.RepoSpec{
+			FromRepo: repov1alpha1.FromRepoOpts{
+				RepoOpts:         repov1alpha1.RepoOpts{Url: url, Branch: "schema"},
+				ValuesSchemaPath: ".krateo/values.schema.json",
+			},
+			ToRepo: repov1alpha1.ToRepoOpts{RepoOpts: repov1alpha1.RepoOpts{Url: url, Branch: "master"}},
+		},
+	}
+	kc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).WithStatusSubresource(cr).Build()
+	e := &external{
+		kube: kc,
+		log:  logging.NewNopLogger(),
+		cfg:  &externalClientOpts{},
+		rec:  record.NewFakeRecorder(10),
+	}
+
+	err = e.Create(ctx, cr)
+	require.ErrorIs(t, err, ErrValuesInvalid)
+
+	// the reconciler discards the in-memory status of a failed Create
+	stored := &repov1alpha1.Repo{}
+	require.NoError(t, kc.Get(ctx, types.NamespacedName{Name: "sample", Namespace: "default"}, stored))
+	cond := stored.GetCondition(repov1alpha1.TypeValuesValid)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, repov1alpha1.ReasonValuesInvalid, cond.Reason)
+}
+
+func TestCreateRecordsOriginRef(t *testing.T) {
+	ctx := context.TODO()
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, repov1alpha1.SchemeBuilder.AddToScheme(scheme))
+
+	cr := &repov1alpha1.Repo{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default"},
+		Spec: repov1alpha1.RepoSpec{
+			FromRepo: repov1alpha1.FromRepoOpts{RepoOpts: repov1alpha1.RepoOpts{Url: url, Branch: "master"}},
+			ToRepo:   repov1alpha1.ToRepoOpts{RepoOpts: repov1alpha1.RepoOpts{Url: url, Branch: "synced", CloneFromBranch: "master"}},
+		},
+	}
+	kc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).WithStatusSubresource(cr).Build()
+	e := &external{
+		kube: kc,
+		log:  logging.NewNopLogger(),
+		cfg:  &externalClientOpts{},
+		rec:  record.NewFakeRecorder(50),
+	}
+
+	require.NoError(t, e.Create(ctx, cr))
+
+	stored := &repov1alpha1.Repo{}
+	require.NoError(t, kc.Get(ctx, types.NamespacedName{Name: "sample", Namespace: "default"}, stored))
+	assert.Equal(t, "master", stored.Status.OriginBranch)
+	assert.Equal(t, "refs/heads/master", stored.Status.OriginRef)
+	assert.Equal(t, "synced", stored.Status.TargetBranch)
+}
@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"sigs.k8s.io/yaml"
+)
+
+var ErrInvalidRules = errors.New("invalid rules manifest")
+
+/*
+rulesManifest is the content of the rules file of the origin repo, e.g.:
+
+	rules:
+	  - include: ["helm/**"]
+	    when: .deployWithHelm
+	  - exclude: ["docs/internal/**"]
+	    when: eq .visibility "public"
+
+The globs are relative to the origin path. The files matching an include rule are copied only if its condition is true,
+the files matching an exclude rule are not copied if its condition is true. A rule without condition always applies.
+*/
+type rulesManifest struct {
+	Rules []rule `json:"rules"`
+}
+
+type rule struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// When is a Go template expression over the values, like the pipeline of an `{{ if }}` action
+	When string `json:"when,omitempty"`
+}
+
+// pathRules are the globs of the rules evaluated against the values, a path matching any of them is not copied.
+type pathRules struct {
+	excluded []string
+}
+
+// loadRules loads the rules file at path in the repository and evaluates its conditions against values.
+// It returns nil if the file does not exist.
+func loadRules(repo *git.Repo, path string, values interface{}) (*pathRules, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	fp, err := repo.FS().Open(filepath.Join("/", path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fp.Close()
+
+	bin, err := io.ReadAll(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest rulesManifest
+	if err := yaml.UnmarshalStrict(bin, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidRules, path, err)
+	}
+
+	res := &pathRules{}
+	for i, r := range manifest.Rules {
+		patterns := r.Include
+		if len(r.Include) > 0 && len(r.Exclude) > 0 || len(r.Include) == 0 && len(r.Exclude) == 0 {
+			return nil, fmt.Errorf("%w: %s: rules[%d]: exactly one of include and exclude must be set", ErrInvalidRules, path, i)
+		}
+		if len(r.Exclude) > 0 {
+			patterns = r.Exclude
+		}
+		for _, p := range patterns {
+			if !doublestar.ValidatePattern(p) {
+				return nil, fmt.Errorf("%w: %s: rules[%d]: invalid glob %q", ErrInvalidRules, path, i, p)
+			}
+		}
+
+		ok, err := evalCondition(r.When, values)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: rules[%d]: %v", ErrInvalidRules, path, i, err)
+		}
+		// included paths are excluded when the condition is false, excluded paths when it is true
+		if ok != (len(r.Include) > 0) {
+			res.excluded = append(res.excluded, patterns...)
+		}
+	}
+	return res, nil
+}
+
+// evalCondition evaluates the Go template expression cond against values, an empty condition is true.
+func evalCondition(cond string, values interface{}) (bool, error) {
+	if strings.TrimSpace(cond) == "" {
+		return true, nil
+	}
+
+	tmpl, err := template.New("when").Funcs(goTemplateFuncMap()).Parse("{{ if " + cond + " }}true{{ end }}")
+	if err != nil {
+		return false, fmt.Errorf("invalid condition %q: %w", cond, err)
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, values); err != nil {
+		return false, fmt.Errorf("unable to evaluate condition %q: %w", cond, err)
+	}
+	return out.String() == "true", nil
+}
+
+// isExcluded reports whether rel, a slash separated path relative to the origin path, must not be copied.
+func (r *pathRules) isExcluded(rel string) bool {
+	if r == nil {
+		return false
+	}
+	for _, p := range r.excluded {
+		if doublestar.MatchUnvalidated(strings.TrimPrefix(p, "/"), rel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"os"
+	"testing"
+
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRules(t *testing.T) {
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	skeleton := map[string]string{
+		"/.krateo/rules.yaml": `rules:
+  - include: ["helm/**"]
+    when: .deployWithHelm
+  - exclude: ["docs/internal/**", "**/*.tmp"]
+    when: eq .visibility "public"
+  - exclude: ["scratch"]
+`,
+		"/skeleton/README.md":            "# {{ name }}\n",
+		"/skeleton/helm/Chart.yaml":      "name: {{ name }}\n",
+		"/skeleton/docs/internal/ops.md": "ops\n",
+		"/skeleton/docs/public.md":       "public\n",
+		"/skeleton/src/cache.tmp":        "tmp\n",
+		"/skeleton/scratch/notes.md":     "notes\n",
+	}
+
+	tests := []struct {
+		name     string
+		values   map[string]interface{}
+		expected []string
+		excluded []string
+	}{
+		{
+			name:     "conditions true",
+			values:   map[string]interface{}{"name": "krateo", "deployWithHelm": true, "visibility": "public"},
+			expected: []string{"/rendered/README.md", "/rendered/helm/Chart.yaml", "/rendered/docs/public.md"},
+			excluded: []string{"/rendered/docs/internal", "/rendered/src/cache.tmp", "/rendered/scratch"},
+		},
+		{
+			name:     "conditions false",
+			values:   map[string]interface{}{"name": "krateo", "deployWithHelm": false, "visibility": "private"},
+			expected: []string{"/rendered/README.md", "/rendered/docs/internal/ops.md", "/rendered/src/cache.tmp"},
+			excluded: []string{"/rendered/helm", "/rendered/scratch"},
+		},
+		{
+			name:     "no values",
+			expected: []string{"/rendered/README.md", "/rendered/docs/internal/ops.md"},
+			excluded: []string{"/rendered/helm", "/rendered/scratch"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := newTestRepo(t, url, skeleton)
+			target := newTestRepo(t, url, nil)
+
+			co := newCopier(origin, target, "/skeleton", "/rendered")
+			rules, err := loadRules(origin, ".krateo/rules.yaml", tt.values)
+			require.NoError(t, err)
+			co.rules = rules
+			require.NoError(t, co.copyDir("/skeleton", "/rendered"))
+
+			for _, name := range tt.expected {
+				_, err := target.FS().Stat(name)
+				assert.NoError(t, err, name)
+			}
+			for _, name := range tt.excluded {
+				_, err := target.FS().Stat(name)
+				assert.True(t, os.IsNotExist(err), name)
+			}
+		})
+	}
+
+	t.Run("invalid manifests", func(t *testing.T) {
+		for _, manifest := range []string{
+			"rules:\n  - include: [a]\n    exclude: [b]\n",
+			"rules:\n  - when: .enabled\n",
+			"rules:\n  - include: [a]\n    when: .enabled )\n",
+			"rules:\n  - include: [\"[a\"]\n",
+			"rules:\n  - includes: [a]\n",
+		} {
+			origin := newTestRepo(t, url, map[string]string{"/.krateo/rules.yaml": manifest})
+			_, err := loadRules(origin, ".krateo/rules.yaml", nil)
+			assert.ErrorIs(t, err, ErrInvalidRules, manifest)
+		}
+	})
+
+	t.Run("missing manifest", func(t *testing.T) {
+		rules, err := loadRules(newTestRepo(t, url, nil), ".krateo/rules.yaml", nil)
+		require.NoError(t, err)
+		assert.Nil(t, rules)
+	})
+}
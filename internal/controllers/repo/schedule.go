@@ -0,0 +1,224 @@
+package repo
+
+import (
+	"fmt"
+	"time"
+
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/provider-runtime/pkg/resource"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// annotationSyncWindowsOverride, set to "true", ignores the schedule and the sync windows
+	annotationSyncWindowsOverride = "git.krateo.io/sync-windows-override"
+
+	syncWindowAllow = "allow"
+
+	// maxScheduleSteps bounds the search of the next allowed sync time
+	maxScheduleSteps = 1000
+	// maxScheduleHorizon is how far in the future the next allowed sync time is searched
+	maxScheduleHorizon = 366 * 24 * time.Hour
+)
+
+// syncPolicy decides when the updates of the target repo are allowed, from the schedule and the sync windows.
+type syncPolicy struct {
+	schedule cron.Schedule
+	windows  []syncWindow
+}
+
+type syncWindow struct {
+	allow    bool
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+// newSyncPolicy returns the sync policy of spec, or nil if spec has neither a schedule nor sync windows.
+func newSyncPolicy(spec *repov1alpha1.RepoSpec) (*syncPolicy, error) {
+	if spec.Schedule == nil && len(spec.SyncWindows) == 0 {
+		return nil, nil
+	}
+
+	p := &syncPolicy{}
+	if spec.Schedule != nil {
+		sched, err := parseCron(spec.Schedule.Cron, spec.Schedule.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule: %w", err)
+		}
+		p.schedule = sched
+	}
+	for i, w := range spec.SyncWindows {
+		sched, err := parseCron(w.Schedule, w.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sync window %d: %w", i, err)
+		}
+		if w.Duration.Duration <= 0 {
+			return nil, fmt.Errorf("invalid sync window %d: duration must be positive", i)
+		}
+		p.windows = append(p.windows, syncWindow{
+			allow:    w.Kind == syncWindowAllow,
+			schedule: sched,
+			duration: w.Duration.Duration,
+		})
+	}
+	return p, nil
+}
+
+func parseCron(expr, timeZone string) (cron.Schedule, error) {
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q: %w", timeZone, err)
+	}
+	sched, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	if s, ok := sched.(*cron.SpecSchedule); ok {
+		s.Location = loc
+	}
+	return sched, nil
+}
+
+// allowed returns true if an update pending since the given time is allowed at t. A nil since means that a scheduled
+// time already passed while the update was pending.
+func (p *syncPolicy) allowed(t time.Time, since *time.Time) bool {
+	return p.due(t, since) && p.windowsAllow(t)
+}
+
+// due returns true if a scheduled time passed since the update is pending.
+func (p *syncPolicy) due(t time.Time, since *time.Time) bool {
+	if p.schedule == nil || since == nil {
+		return true
+	}
+	next := p.schedule.Next(*since)
+	return !next.IsZero() && !next.After(t)
+}
+
+func (p *syncPolicy) windowsAllow(t time.Time) bool {
+	hasAllow, inAllow := false, false
+	for _, w := range p.windows {
+		active := w.active(t)
+		if !w.allow && active {
+			return false
+		}
+		if w.allow {
+			hasAllow = true
+			inAllow = inAllow || active
+		}
+	}
+	return !hasAllow || inAllow
+}
+
+// active returns true if t is within the window, started at most duration before t.
+func (w syncWindow) active(t time.Time) bool {
+	start := w.schedule.Next(t.Add(-w.duration))
+	return !start.IsZero() && !start.After(t)
+}
+
+// next returns the first time after t the window may start or end.
+func (w syncWindow) next(t time.Time) time.Time {
+	res := w.schedule.Next(t)
+	if start := w.schedule.Next(t.Add(-w.duration)); !start.IsZero() && !start.After(t) {
+		if end := start.Add(w.duration); res.IsZero() || end.Before(res) {
+			res = end
+		}
+	}
+	return res
+}
+
+// nextAllowed returns the earliest time, not before now, an update pending since the given time is allowed. It returns
+// false if no update is allowed within maxScheduleHorizon.
+func (p *syncPolicy) nextAllowed(now time.Time, since *time.Time) (time.Time, bool) {
+	t := now
+	for i := 0; i < maxScheduleSteps && t.Sub(now) <= maxScheduleHorizon; i++ {
+		if p.allowed(t, since) {
+			return t, true
+		}
+
+		// the decision only changes when a scheduled time passes or a window starts or ends
+		var next time.Time
+		earliest := func(c time.Time) {
+			if !c.IsZero() && c.After(t) && (next.IsZero() || c.Before(next)) {
+				next = c
+			}
+		}
+		if !p.due(t, since) {
+			earliest(p.schedule.Next(*since))
+		}
+		for _, w := range p.windows {
+			earliest(w.next(t))
+		}
+		if next.IsZero() {
+			return time.Time{}, false
+		}
+		t = next
+	}
+	return time.Time{}, false
+}
+
+// deferSync returns true if the update of the target repo is not allowed at now by the schedule and the sync windows,
+// setting status.nextSyncTime to the earliest time it will be allowed. Pending sync requests are never deferred.
+func (e *external) deferSync(cr *repov1alpha1.Repo, now time.Time) (bool, error) {
+	policy, err := newSyncPolicy(&cr.Spec)
+	if err != nil {
+		e.rec.Eventf(cr, corev1.EventTypeWarning, "InvalidSyncPolicy", "Unable to parse schedule and sync windows: %s", err.Error())
+		return false, err
+	}
+	if policy == nil {
+		cr.Status.NextSyncTime = nil
+		return false, nil
+	}
+	if cr.GetAnnotations()[annotationSyncWindowsOverride] == "true" {
+		e.log.Info("Schedule and sync windows overridden by annotation", "annotation", annotationSyncWindowsOverride)
+		cr.Status.NextSyncTime = nil
+		return false, nil
+	}
+	if req := pendingSyncRequest(cr); req != "" {
+		e.log.Info("Schedule and sync windows skipped for the sync request", "annotation", annotationSyncRequestedAt, "value", req)
+		cr.Status.NextSyncTime = nil
+		return false, nil
+	}
+
+	// the update is pending since the previous observation if a sync time was already computed
+	since := &now
+	if next := cr.Status.NextSyncTime; next != nil && !now.Before(next.Time) {
+		since = nil
+	}
+	if policy.allowed(now, since) {
+		// status.nextSyncTime is kept until the synchronization succeeds, so that failures are retried
+		return false, nil
+	}
+
+	next, ok := policy.nextAllowed(now, since)
+	if !ok {
+		cr.Status.NextSyncTime = nil
+		e.log.Info("Update deferred, no sync allowed by the schedule and the sync windows in the next year")
+		e.rec.Eventf(cr, corev1.EventTypeWarning, "SyncDeferred",
+			"Target repo update deferred, no sync allowed by the schedule and the sync windows in the next year")
+		return true, nil
+	}
+	if prev := cr.Status.NextSyncTime; prev == nil || !prev.Time.Equal(next) {
+		e.rec.Eventf(cr, corev1.EventTypeNormal, "SyncDeferred",
+			"Target repo update deferred to %s by the schedule and the sync windows", next.UTC().Format(time.RFC3339))
+	}
+	e.log.Info("Update deferred by the schedule and the sync windows", "nextSyncTime", next)
+	cr.Status.NextSyncTime = &metav1.Time{Time: next}
+	return true, nil
+}
+
+// requeueAtNextSync shortens the poll interval so that a deferred update is applied as soon as it is allowed.
+func requeueAtNextSync(mg resource.Managed, pollInterval time.Duration) time.Duration {
+	cr, ok := mg.(*repov1alpha1.Repo)
+	if !ok || cr.Status.NextSyncTime == nil {
+		return pollInterval
+	}
+	if until := time.Until(cr.Status.NextSyncTime.Time); until > 0 && until < pollInterval {
+		return until
+	}
+	return pollInterval
+}
@@ -0,0 +1,171 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSyncPolicy(t *testing.T) {
+	// 2024-01-15 is a Monday
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, time.January, day, hour, min, 0, 0, time.UTC)
+	}
+	window := func(kind, schedule string, d time.Duration) repov1alpha1.SyncWindow {
+		return repov1alpha1.SyncWindow{Kind: kind, Schedule: schedule, Duration: metav1.Duration{Duration: d}}
+	}
+
+	tests := []struct {
+		name     string
+		spec     repov1alpha1.RepoSpec
+		now      time.Time
+		pending  bool
+		allowed  bool
+		expected time.Time
+	}{
+		{
+			name:    "deny window active",
+			spec:    repov1alpha1.RepoSpec{SyncWindows: []repov1alpha1.SyncWindow{window("deny", "0 9 * * 1-5", 8*time.Hour)}},
+			now:     at(15, 10, 0),
+			allowed: false, expected: at(15, 17, 0),
+		},
+		{
+			name:    "deny window not active",
+			spec:    repov1alpha1.RepoSpec{SyncWindows: []repov1alpha1.SyncWindow{window("deny", "0 9 * * 1-5", 8*time.Hour)}},
+			now:     at(13, 10, 0),
+			allowed: true, expected: at(13, 10, 0),
+		},
+		{
+			name:    "outside allow window",
+			spec:    repov1alpha1.RepoSpec{SyncWindows: []repov1alpha1.SyncWindow{window("allow", "0 22 * * *", 2*time.Hour)}},
+			now:     at(15, 12, 0),
+			allowed: false, expected: at(15, 22, 0),
+		},
+		{
+			name:    "inside allow window",
+			spec:    repov1alpha1.RepoSpec{SyncWindows: []repov1alpha1.SyncWindow{window("allow", "0 22 * * *", 2*time.Hour)}},
+			now:     at(15, 23, 30),
+			allowed: true, expected: at(15, 23, 30),
+		},
+		{
+			name: "deny overrides allow",
+			spec: repov1alpha1.RepoSpec{SyncWindows: []repov1alpha1.SyncWindow{
+				window("allow", "0 20 * * *", 4*time.Hour),
+				window("deny", "0 20 * * *", time.Hour),
+			}},
+			now:     at(15, 20, 30),
+			allowed: false, expected: at(15, 21, 0),
+		},
+		{
+			name:    "schedule waits for the next scheduled time",
+			spec:    repov1alpha1.RepoSpec{Schedule: &repov1alpha1.ScheduleOpts{Cron: "0 2 * * *"}},
+			now:     at(15, 12, 0),
+			allowed: false, expected: at(16, 2, 0),
+		},
+		{
+			name:    "schedule passed while pending",
+			spec:    repov1alpha1.RepoSpec{Schedule: &repov1alpha1.ScheduleOpts{Cron: "0 2 * * *"}},
+			now:     at(16, 2, 1),
+			pending: true,
+			allowed: true, expected: at(16, 2, 1),
+		},
+		{
+			name:    "schedule in time zone",
+			spec:    repov1alpha1.RepoSpec{Schedule: &repov1alpha1.ScheduleOpts{Cron: "0 2 * * *", TimeZone: "Europe/Rome"}},
+			now:     at(15, 12, 0),
+			allowed: false, expected: at(16, 1, 0),
+		},
+		{
+			name: "schedule within deny window",
+			spec: repov1alpha1.RepoSpec{
+				Schedule:    &repov1alpha1.ScheduleOpts{Cron: "0 2 * * *"},
+				SyncWindows: []repov1alpha1.SyncWindow{window("deny", "0 1 * * *", 3*time.Hour)},
+			},
+			now:     at(15, 12, 0),
+			allowed: false, expected: at(16, 4, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newSyncPolicy(&tt.spec)
+			require.NoError(t, err)
+			since := &tt.now
+			if tt.pending {
+				since = nil
+			}
+			assert.Equal(t, tt.allowed, p.allowed(tt.now, since))
+			next, ok := p.nextAllowed(tt.now, since)
+			require.True(t, ok)
+			assert.True(t, tt.expected.Equal(next), "expected %s, got %s", tt.expected, next)
+		})
+	}
+
+	p, err := newSyncPolicy(&repov1alpha1.RepoSpec{})
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	for _, spec := range []repov1alpha1.RepoSpec{
+		{Schedule: &repov1alpha1.ScheduleOpts{Cron: "every day"}},
+		{Schedule: &repov1alpha1.ScheduleOpts{Cron: "0 2 * * *", TimeZone: "Mars/Olympus"}},
+		{SyncWindows: []repov1alpha1.SyncWindow{window("allow", "0 2 * * *", 0)}},
+	} {
+		_, err := newSyncPolicy(&spec)
+		assert.Error(t, err)
+	}
+}
+
+func TestDeferSync(t *testing.T) {
+	now := time.Date(2024, time.January, 15, 12, 0, 0, 0, time.UTC)
+	e := &external{log: logging.NewNopLogger(), rec: record.NewFakeRecorder(10)}
+
+	cr := &repov1alpha1.Repo{
+		Spec: repov1alpha1.RepoSpec{Schedule: &repov1alpha1.ScheduleOpts{Cron: "0 2 * * *"}},
+	}
+	deferred, err := e.deferSync(cr, now)
+	require.NoError(t, err)
+	assert.True(t, deferred)
+	require.NotNil(t, cr.Status.NextSyncTime)
+	next := cr.Status.NextSyncTime.Time
+	assert.True(t, next.Equal(time.Date(2024, time.January, 16, 2, 0, 0, 0, time.UTC)))
+
+	// still deferred before the next sync time, allowed after it
+	deferred, err = e.deferSync(cr, next.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.True(t, deferred)
+	deferred, err = e.deferSync(cr, next.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, deferred)
+	assert.NotNil(t, cr.Status.NextSyncTime, "kept until the synchronization succeeds")
+
+	cr.Status.NextSyncTime = nil
+	cr.SetAnnotations(map[string]string{annotationSyncWindowsOverride: "true"})
+	deferred, err = e.deferSync(cr, now)
+	require.NoError(t, err)
+	assert.False(t, deferred)
+	assert.Nil(t, cr.Status.NextSyncTime)
+
+	// a pending sync request is performed immediately, a handled one is deferred again
+	cr.SetAnnotations(map[string]string{annotationSyncRequestedAt: "2024-01-15T12:00:00Z"})
+	deferred, err = e.deferSync(cr, now)
+	require.NoError(t, err)
+	assert.False(t, deferred)
+	assert.Nil(t, cr.Status.NextSyncTime)
+
+	cr.Status.LastHandledSyncRequest = "2024-01-15T12:00:00Z"
+	deferred, err = e.deferSync(cr, now)
+	require.NoError(t, err)
+	assert.True(t, deferred)
+
+	cr.SetAnnotations(nil)
+	cr.Spec.Schedule = nil
+	deferred, err = e.deferSync(cr, now)
+	require.NoError(t, err)
+	assert.False(t, deferred)
+}
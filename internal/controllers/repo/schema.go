@@ -0,0 +1,168 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+const valuesSchemaURL = "file:///values.schema.json"
+
+var (
+	ErrValuesInvalid = errors.New("template values do not satisfy the schema")
+	ErrInvalidSchema = errors.New("invalid template values schema")
+)
+
+// noRemoteLoader prevents the schema from referencing local files or remote URLs.
+type noRemoteLoader struct{}
+
+func (noRemoteLoader) Load(url string) (any, error) {
+	return nil, fmt.Errorf("loading %q is not allowed: only local references ('#/...') are supported", url)
+}
+
+// valuesSchema is a JSON Schema for the template values loaded from the origin repo.
+type valuesSchema struct {
+	compiled *jsonschema.Schema
+	// raw is the schema decoded with encoding/json, defaults are taken from here so that numbers are float64 like the values ones
+	raw interface{}
+}
+
+// loadValuesSchema loads the schema at path in the repository. It returns nil if the file does not exist.
+func loadValuesSchema(repo *git.Repo, path string) (*valuesSchema, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	fp, err := repo.FS().Open(filepath.Join("/", path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fp.Close()
+
+	bin, err := io.ReadAll(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(bin))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidSchema, path, err)
+	}
+
+	c := jsonschema.NewCompiler()
+	c.UseLoader(noRemoteLoader{})
+	if err := c.AddResource(valuesSchemaURL, doc); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidSchema, path, err)
+	}
+	compiled, err := c.Compile(valuesSchemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidSchema, path, err)
+	}
+
+	res := &valuesSchema{compiled: compiled}
+	if err := json.Unmarshal(bin, &res.raw); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidSchema, path, err)
+	}
+	return res, nil
+}
+
+// Validate applies the schema defaults to values and validates the result, errors are reported with the JSON pointer of the invalid values.
+func (s *valuesSchema) Validate(values map[string]interface{}) (map[string]interface{}, error) {
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	applySchemaDefaults(s.raw, values)
+
+	err := s.compiled.Validate(toSchemaInstance(values))
+	if err == nil {
+		return values, nil
+	}
+
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return nil, fmt.Errorf("%w: %v", ErrValuesInvalid, err)
+	}
+
+	seen := map[string]bool{}
+	var violations []string
+	for _, unit := range ve.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		loc := unit.InstanceLocation
+		if loc == "" {
+			loc = "/"
+		}
+		msg := fmt.Sprintf("%s: %s", loc, unit.Error.String())
+		if !seen[msg] {
+			seen[msg] = true
+			violations = append(violations, msg)
+		}
+	}
+	sort.Strings(violations)
+
+	return nil, fmt.Errorf("%w: %s", ErrValuesInvalid, strings.Join(violations, "; "))
+}
+
+// applySchemaDefaults sets the `default` of the schema properties missing in values, recursively.
+func applySchemaDefaults(schema interface{}, values map[string]interface{}) {
+	sch, ok := schema.(map[string]interface{})
+	if !ok {
+		return
+	}
+	props, ok := sch["properties"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for name, prop := range props {
+		propSchema, ok := prop.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if _, found := values[name]; !found {
+			if def, ok := propSchema["default"]; ok {
+				values[name] = def
+				continue
+			}
+			if _, ok := propSchema["properties"]; ok {
+				nested := map[string]interface{}{}
+				applySchemaDefaults(propSchema, nested)
+				if len(nested) > 0 {
+					values[name] = nested
+				}
+			}
+			continue
+		}
+
+		if nested, ok := values[name].(map[string]interface{}); ok {
+			applySchemaDefaults(propSchema, nested)
+		}
+	}
+}
+
+// toSchemaInstance converts the values to the representation expected by the validator.
+func toSchemaInstance(values map[string]interface{}) interface{} {
+	bin, err := json.Marshal(values)
+	if err != nil {
+		return values
+	}
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(bin))
+	if err != nil {
+		return values
+	}
+	return inst
+}
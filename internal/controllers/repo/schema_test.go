@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"os"
+	"testing"
+
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValuesSchema(t *testing.T) {
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	repo, err := git.Clone(git.CloneOptions{
+		URL: baseRepo.GetBasicLocalRepositoryURL(),
+	})
+	require.NoError(t, err)
+	defer repo.Cleanup()
+
+	writeSchema := func(t *testing.T, path, content string) {
+		require.NoError(t, repo.FS().MkdirAll(".krateo", 0755))
+		f, err := repo.FS().OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	t.Run("schema not found", func(t *testing.T) {
+		schema, err := loadValuesSchema(repo, ".krateo/values.schema.json")
+		require.NoError(t, err)
+		assert.Nil(t, schema)
+	})
+
+	writeSchema(t, ".krateo/values.schema.json", `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string"},
+			"replicas": {"type": "integer", "default": 1},
+			"service": {
+				"type": "object",
+				"properties": {
+					"type": {"type": "string", "enum": ["ClusterIP", "NodePort"], "default": "ClusterIP"},
+					"port": {"type": "integer", "default": 80}
+				}
+			}
+		}
+	}`)
+
+	schema, err := loadValuesSchema(repo, ".krateo/values.schema.json")
+	require.NoError(t, err)
+	require.NotNil(t, schema)
+
+	t.Run("defaults", func(t *testing.T) {
+		values, err := schema.Validate(map[string]interface{}{
+			"name":    "krateo",
+			"service": map[string]interface{}{"port": float64(8080)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"name":     "krateo",
+			"replicas": float64(1),
+			"service": map[string]interface{}{
+				"type": "ClusterIP",
+				"port": float64(8080),
+			},
+		}, values)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		_, err := schema.Validate(map[string]interface{}{
+			"replicas": "two",
+			"service":  map[string]interface{}{"type": "LoadBalancer"},
+		})
+		require.ErrorIs(t, err, ErrValuesInvalid)
+		assert.ErrorContains(t, err, "/replicas:")
+		assert.ErrorContains(t, err, "/service/type:")
+		assert.ErrorContains(t, err, "name")
+	})
+
+	t.Run("remote references are not loaded", func(t *testing.T) {
+		writeSchema(t, ".krateo/remote.schema.json", `{"$ref": "file:///etc/passwd"}`)
+		_, err := loadValuesSchema(repo, ".krateo/remote.schema.json")
+		assert.ErrorIs(t, err, ErrInvalidSchema)
+	})
+}
@@ -14,15 +14,23 @@ import (
 	"github.com/krateoplatformops/provider-runtime/pkg/logging"
 	"github.com/krateoplatformops/provider-runtime/pkg/ratelimiter"
 	"github.com/krateoplatformops/provider-runtime/pkg/resource"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlevent "sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/pkg/errors"
 )
 
-// Setup adds a controller that reconciles Token managed resources.
-func Setup(mgr ctrl.Manager, o controller.Options) error {
+// Setup adds a controller that reconciles Token managed resources. The Repos received from triggers, if not nil, are
+// reconciled immediately.
+func Setup(mgr ctrl.Manager, o controller.Options, triggers <-chan ctrlevent.GenericEvent) error {
 	name := reconciler.ControllerName(repov1alpha1.RepoGroupKind)
 
 	log := o.Logger.WithValues("controller", name)
@@ -30,31 +38,73 @@ func Setup(mgr ctrl.Manager, o controller.Options) error {
 	recorder := mgr.GetEventRecorderFor(name)
 
 	timeout := env.Duration("GIT_PROVIDER_TIMEOUT", 4*time.Minute)
+	pushRetries := env.Int("GIT_PROVIDER_PUSH_RETRIES", 3)
 
 	r := reconciler.NewReconciler(mgr,
 		resource.ManagedKind(repov1alpha1.RepoGroupVersionKind),
 		reconciler.WithExternalConnecter(&connector{
-			kube:     mgr.GetClient(),
-			log:      log,
-			recorder: recorder,
+			kube:        mgr.GetClient(),
+			log:         log,
+			recorder:    recorder,
+			pushRetries: pushRetries,
 		}),
 		reconciler.WithPollInterval(o.PollInterval),
+		reconciler.WithPollIntervalHook(requeueAtNextSync),
 		reconciler.WithLogger(log),
 		reconciler.WithRecorder(event.NewAPIRecorder(recorder)),
 		reconciler.WithTimeout(timeout),
 	)
 
-	return ctrl.NewControllerManagedBy(mgr).
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &repov1alpha1.Repo{}, valuesRefIndex, func(obj client.Object) []string {
+		cr, ok := obj.(*repov1alpha1.Repo)
+		if !ok {
+			return nil
+		}
+		return valuesRefs(&cr.Spec)
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot index repos by values references")
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		WithOptions(o.ForControllerRuntime()).
 		For(&repov1alpha1.Repo{}).
-		Complete(ratelimiter.New(name, r, o.GlobalRateLimiter))
+		// the mapping only needs namespace and name, so only the metadata of ConfigMaps and Secrets is cached
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(enqueueReposReferencing(mgr.GetClient(), valuesRefConfigMap)), builder.OnlyMetadata).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(enqueueReposReferencing(mgr.GetClient(), valuesRefSecret)), builder.OnlyMetadata)
+	if triggers != nil {
+		b = b.WatchesRawSource(source.Channel(triggers, &handler.EnqueueRequestForObject{}))
+	}
+	return b.Complete(ratelimiter.New(name, r, o.GlobalRateLimiter))
+}
+
+// enqueueReposReferencing maps a ConfigMap or Secret to the Repos using it as a source of template values.
+func enqueueReposReferencing(kube client.Client, kind string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		list := &repov1alpha1.RepoList{}
+		err := kube.List(ctx, list, client.MatchingFields{
+			valuesRefIndex: valuesRefKey(kind, obj.GetNamespace(), obj.GetName()),
+		})
+		if err != nil {
+			return nil
+		}
+
+		res := make([]reconcile.Request, 0, len(list.Items))
+		for _, cr := range list.Items {
+			res = append(res, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: cr.Namespace, Name: cr.Name},
+			})
+		}
+		return res
+	}
 }
 
 type connector struct {
-	kube     client.Client
-	log      logging.Logger
-	recorder record.EventRecorder
+	kube        client.Client
+	log         logging.Logger
+	recorder    record.EventRecorder
+	pushRetries int
 }
 
 func (c *connector) Connect(ctx context.Context, mg resource.Managed) (reconciler.ExternalClient, error) {
@@ -76,9 +126,10 @@ func (c *connector) Connect(ctx context.Context, mg resource.Managed) (reconcile
 	log := c.log.WithValues("name", cr.Name, "namespace", cr.Namespace)
 
 	return &external{
-		kube: c.kube,
-		log:  log,
-		cfg:  cfg,
-		rec:  c.recorder,
+		kube:        c.kube,
+		log:         log,
+		cfg:         cfg,
+		rec:         c.recorder,
+		pushRetries: c.pushRetries,
 	}, nil
 }
@@ -0,0 +1,358 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/cbroglie/mustache"
+)
+
+var ErrMissingVariables = errors.New("unresolved template variables")
+
+// missingVariable is a template variable not found in the values.
+type missingVariable struct {
+	// File is the origin file the variable was found in
+	File string
+	// Line is the line of the file the variable was found in, 0 if the variable is part of the file name
+	Line int
+	Name string
+}
+
+func (mv missingVariable) String() string {
+	if mv.Line == 0 {
+		return fmt.Sprintf("%s (file name): %s", mv.File, mv.Name)
+	}
+	return fmt.Sprintf("%s:%d: %s", mv.File, mv.Line, mv.Name)
+}
+
+// missingVariablesError is returned by the render functions in strict mode.
+type missingVariablesError struct {
+	vars []missingVariable
+}
+
+func (e *missingVariablesError) Error() string {
+	names := make([]string, 0, len(e.vars))
+	for _, v := range e.vars {
+		names = append(names, v.String())
+	}
+	return fmt.Sprintf("%s: %s", ErrMissingVariables, strings.Join(names, ", "))
+}
+
+func (e *missingVariablesError) Unwrap() error {
+	return ErrMissingVariables
+}
+
+// maxMustachePartialsDepth limits the expansion of (recursive) partials.
+const maxMustachePartialsDepth = 10
+
+// mustacheNode is a tag of a mustache template.
+type mustacheNode struct {
+	section  bool
+	inverted bool
+	// partial is true for a partial tag, the children are the tags of the partial
+	partial  bool
+	name     string
+	line     int
+	children []*mustacheNode
+}
+
+/*
+findMissingMustacheVariables returns the variables and sections of a (syntactically valid) mustache template that cannot be resolved against values.
+  - variables inside sections not rendered (false or empty) are not reported, inverted sections are never reported
+  - partials, if not nil, are looked up and their variables resolved against the context of the partial tag: they are reported at the
+    line of the tag, qualified with the partial name
+*/
+func findMissingMustacheVariables(text string, values interface{}, partials mustache.PartialProvider) []missingVariable {
+	var res []missingVariable
+	walkMustacheNodes(parseMustacheNodes(text, partials, 0), []interface{}{values}, nil, "", &res)
+	return res
+}
+
+// parseMustacheNodes returns the tags of a mustache template, depth is the number of partials being expanded.
+func parseMustacheNodes(text string, partials mustache.PartialProvider, depth int) []*mustacheNode {
+	root := &mustacheNode{section: true}
+	stack := []*mustacheNode{root}
+
+	otag, ctag := "{{", "}}"
+	line := 1
+	for p := 0; p < len(text); {
+		start := strings.Index(text[p:], otag)
+		if start < 0 {
+			break
+		}
+		line += strings.Count(text[p:p+start], "\n")
+		p += start + len(otag)
+
+		closing := ctag
+		if p < len(text) && text[p] == '{' {
+			closing = "}" + ctag
+		}
+		end := strings.Index(text[p:], closing)
+		if end < 0 {
+			break
+		}
+		tag := strings.TrimSpace(text[p : p+end])
+		tagLine := line
+		line += strings.Count(text[p:p+end], "\n")
+		p += end + len(closing)
+
+		if len(tag) == 0 {
+			continue
+		}
+
+		parent := stack[len(stack)-1]
+		switch tag[0] {
+		case '!':
+		case '>':
+			if partials == nil || depth >= maxMustachePartialsDepth {
+				continue
+			}
+			node := &mustacheNode{partial: true, name: strings.TrimSpace(tag[1:]), line: tagLine}
+			// a missing or invalid partial renders empty
+			if content, err := partials.Get(node.name); err == nil {
+				node.children = parseMustacheNodes(content, partials, depth+1)
+			}
+			parent.children = append(parent.children, node)
+		case '=':
+			if delims := strings.Fields(strings.Trim(tag, "=")); len(delims) == 2 {
+				otag, ctag = delims[0], delims[1]
+			}
+		case '#', '^':
+			node := &mustacheNode{
+				section:  true,
+				inverted: tag[0] == '^',
+				name:     strings.TrimSpace(tag[1:]),
+				line:     tagLine,
+			}
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+		case '/':
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case '&', '{':
+			parent.children = append(parent.children, &mustacheNode{name: strings.TrimSpace(tag[1:]), line: tagLine})
+		default:
+			parent.children = append(parent.children, &mustacheNode{name: tag, line: tagLine})
+		}
+	}
+
+	return root.children
+}
+
+// walkMustacheNodes resolves the nodes against the context chain. Inside partials, at is the outermost partial tag and
+// partial the name of the innermost partial.
+func walkMustacheNodes(nodes []*mustacheNode, chain []interface{}, at *mustacheNode, partial string, res *[]missingVariable) {
+	report := func(n *mustacheNode) {
+		if at == nil {
+			*res = append(*res, missingVariable{Line: n.line, Name: n.name})
+			return
+		}
+		*res = append(*res, missingVariable{Line: at.line, Name: fmt.Sprintf("%s (partial %s)", n.name, partial)})
+	}
+
+	for _, n := range nodes {
+		if n.partial {
+			outer := at
+			if outer == nil {
+				outer = n
+			}
+			walkMustacheNodes(n.children, chain, outer, n.name, res)
+			continue
+		}
+
+		val, found := lookupValue(chain, n.name)
+
+		if !n.section {
+			if !found {
+				report(n)
+			}
+			continue
+		}
+
+		if n.inverted {
+			if !found || isFalsy(val) {
+				walkMustacheNodes(n.children, chain, at, partial, res)
+			}
+			continue
+		}
+
+		if !found {
+			report(n)
+			continue
+		}
+		if isFalsy(val) {
+			continue
+		}
+
+		if list, ok := val.([]interface{}); ok {
+			for _, el := range list {
+				walkMustacheNodes(n.children, append([]interface{}{el}, chain...), at, partial, res)
+			}
+			continue
+		}
+		walkMustacheNodes(n.children, append([]interface{}{val}, chain...), at, partial, res)
+	}
+}
+
+// lookupValue resolves a (dotted) name against a mustache context chain, innermost context first.
+func lookupValue(chain []interface{}, name string) (interface{}, bool) {
+	if name == "." {
+		return chain[0], true
+	}
+
+	first, rest, dotted := strings.Cut(name, ".")
+	for _, ctx := range chain {
+		m, ok := ctx.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		val, ok := m[first]
+		if !ok {
+			continue
+		}
+		if !dotted {
+			return val, true
+		}
+		return lookupValue([]interface{}{val}, rest)
+	}
+	return nil, false
+}
+
+func isFalsy(val interface{}) bool {
+	if val == nil {
+		return true
+	}
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		return v.Len() == 0
+	case reflect.String:
+		return len(strings.TrimSpace(v.String())) == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// goTemplateErrorRe matches the location of a text/template execution error. The error of a partial called with
+// include is nested in the error of the include call, so an error can have more than one match.
+var goTemplateErrorRe = regexp.MustCompile(`template: (([^:]*):(\d+):\d+): executing "[^"]*" at <[^>]*>: `)
+
+const goTemplateMissingKeyMsg = "map has no entry for key"
+
+// goTemplateMissingKey is a missing key error of text/template, raised with the `missingkey=error` option.
+type goTemplateMissingKey struct {
+	// template is the name of the template containing the node that cannot be evaluated
+	template string
+	// location is the location of the node, as returned by template.ErrorContext
+	location string
+	// line is the line of the root template the error was raised at, the one of the partial if the root template
+	// does not appear in the error (partials called with `template`)
+	line int
+}
+
+// parseGoTemplateMissingKey parses a missing key error of text/template raised executing the root template, it returns false for any other error.
+func parseGoTemplateMissingKey(root string, err error) (goTemplateMissingKey, bool) {
+	msg := err.Error()
+	ms := goTemplateErrorRe.FindAllStringSubmatchIndex(msg, -1)
+	if len(ms) == 0 {
+		return goTemplateMissingKey{}, false
+	}
+	outer, inner := ms[0], ms[len(ms)-1]
+	if !strings.HasPrefix(msg[inner[1]:], goTemplateMissingKeyMsg) {
+		return goTemplateMissingKey{}, false
+	}
+
+	at := outer
+	if msg[outer[4]:outer[5]] != root {
+		at = inner
+	}
+	line, _ := strconv.Atoi(msg[at[6]:at[7]])
+
+	return goTemplateMissingKey{
+		template: msg[inner[4]:inner[5]],
+		location: msg[inner[2]:inner[3]],
+		line:     line,
+	}, true
+}
+
+// goTemplateMissingFunc is the function replacing the nodes of missing values, to go on with the execution.
+const goTemplateMissingFunc = "strictMissingValue"
+
+/*
+skipMissingGoTemplateKey replaces the node that raised mk with a call to goTemplateMissingFunc, so that the template can be executed
+again to find the next missing key. It returns the missing variable, or false if the node is not found.
+*/
+func skipMissingGoTemplateKey(tmpl *template.Template, mk goTemplateMissingKey) (missingVariable, bool) {
+	t := tmpl.Lookup(mk.template)
+	if t == nil || t.Tree == nil {
+		return missingVariable{}, false
+	}
+
+	var missing parse.Node
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.CommandNode:
+			for i, arg := range n.Args {
+				switch arg.(type) {
+				case *parse.FieldNode, *parse.VariableNode, *parse.ChainNode:
+					if location, _ := t.ErrorContext(arg); location == mk.location && missing == nil {
+						missing = arg
+						n.Args[i] = parse.NewIdentifier(goTemplateMissingFunc).SetTree(t.Tree).SetPos(arg.Position())
+						continue
+					}
+				}
+				walk(arg)
+			}
+		}
+	}
+	walk(t.Tree.Root)
+	if missing == nil {
+		return missingVariable{}, false
+	}
+
+	name := strings.TrimPrefix(missing.String(), ".")
+	if mk.template != tmpl.Name() {
+		name = fmt.Sprintf("%s (partial %s)", name, mk.template)
+	}
+	return missingVariable{Line: mk.line, Name: name}, true
+}
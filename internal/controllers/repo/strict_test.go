@@ -0,0 +1,172 @@
+package repo
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cbroglie/mustache"
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindMissingMustacheVariables(t *testing.T) {
+	values := map[string]interface{}{
+		"name":    "krateo",
+		"enabled": false,
+		"service": map[string]interface{}{"port": float64(80)},
+		"items": []interface{}{
+			map[string]interface{}{"id": "a"},
+			map[string]interface{}{"id": "b", "label": "B"},
+		},
+	}
+
+	partials := &mustache.StaticProvider{Partials: map[string]string{
+		"header":    "# {{ name }} by {{ owner }}",
+		"item":      "{{ id }}: {{ label }}",
+		"recursive": "{{ depth }}{{> recursive }}",
+		"nested":    "{{> header }}",
+	}}
+
+	tests := []struct {
+		name     string
+		template string
+		expected []missingVariable
+	}{
+		{
+			name:     "all resolved",
+			template: "{{ name }}\n{{{ service.port }}}\n{{# items }}{{ id }}-{{ name }}{{/ items }}",
+		},
+		{
+			name:     "missing variables",
+			template: "name: {{ name }}\nimage: {{ image.tag }}\nport: {{ service.port }}\nhost: {{& service.host }}\n",
+			expected: []missingVariable{
+				{Line: 2, Name: "image.tag"},
+				{Line: 4, Name: "service.host"},
+			},
+		},
+		{
+			name:     "custom delimiters",
+			template: "{{=<% %>=}}\nname: <% name %>\nowner: <% owner %>\nraw: {{ ignored }}",
+			expected: []missingVariable{
+				{Line: 3, Name: "owner"},
+			},
+		},
+		{
+			name:     "sections",
+			template: "{{# enabled }}{{ notRendered }}{{/ enabled }}\n{{^ disabled }}\n{{ fallback }}\n{{/ disabled }}\n{{# items }}\n{{ label }}\n{{/ items }}\n{{# missing }}{{/ missing }}",
+			expected: []missingVariable{
+				{Line: 3, Name: "fallback"},
+				{Line: 6, Name: "label"},
+				{Line: 8, Name: "missing"},
+			},
+		},
+		{
+			name:     "partials",
+			template: "{{> header }}\n{{# items }}\n{{> item }}\n{{/ items }}\n{{# enabled }}{{> header }}{{/ enabled }}\n{{> nested }}\n{{> unknown }}",
+			expected: []missingVariable{
+				{Line: 1, Name: "owner (partial header)"},
+				{Line: 3, Name: "label (partial item)"},
+				{Line: 6, Name: "owner (partial header)"},
+			},
+		},
+		{
+			name:     "recursive partial",
+			template: "{{# enabled }}{{> recursive }}{{/ enabled }}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, findMissingMustacheVariables(tt.template, values, partials))
+		})
+	}
+}
+
+func TestStrictTemplating(t *testing.T) {
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	origin, err := git.Clone(git.CloneOptions{
+		URL: baseRepo.GetBasicLocalRepositoryURL(),
+	})
+	require.NoError(t, err)
+	defer origin.Cleanup()
+
+	target, err := git.Clone(git.CloneOptions{
+		URL: baseRepo.GetBasicLocalRepositoryURL(),
+	})
+	require.NoError(t, err)
+	defer target.Cleanup()
+
+	files := map[string]string{
+		"/skeleton/values.yaml":          "name: {{ name }}\nimage:\n  tag: {{ image.tag }}\n",
+		"/skeleton/{{ component }}.yaml": "kind: {{ kind }}\n",
+		"/skeleton/docs/README.md":       "# {{ name }}\n",
+	}
+	for name, content := range files {
+		require.NoError(t, origin.FS().MkdirAll(name[:strings.LastIndex(name, "/")], 0755))
+		f, err := origin.FS().OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	e := &external{}
+	values := map[string]interface{}{"name": "krateo"}
+
+	t.Run("mustache", func(t *testing.T) {
+		co := newCopier(origin, target, "/skeleton", "/rendered")
+		createRenderFuncs(co, values, renderOpts{strict: true})
+
+		err := e.copyToTarget(co, true, "/skeleton", "/rendered")
+		require.ErrorIs(t, err, ErrMissingVariables)
+		assert.ElementsMatch(t, []missingVariable{
+			{File: "/skeleton/values.yaml", Line: 3, Name: "image.tag"},
+			{File: "/skeleton/{{ component }}.yaml", Line: 0, Name: "component"},
+			{File: "/skeleton/{{ component }}.yaml", Line: 1, Name: "kind"},
+		}, co.missing)
+		assert.ErrorContains(t, err, "/skeleton/values.yaml:3: image.tag")
+	})
+
+	t.Run("gotemplate", func(t *testing.T) {
+		co := newCopier(origin, target, "/skeleton", "/rendered")
+		createRenderFuncs(co, values, renderOpts{engine: "gotemplate", strict: true})
+
+		var out strings.Builder
+		err := co.renderFunc("/values.yaml", strings.NewReader("name: {{ .name }}\n\ntag: {{ .image.tag }}\n"), &out)
+		var mve *missingVariablesError
+		require.ErrorAs(t, err, &mve)
+		assert.Equal(t, []missingVariable{{Line: 3, Name: "image.tag"}}, mve.vars)
+	})
+
+	t.Run("gotemplate every missing key", func(t *testing.T) {
+		text := "name: {{ .name }}\nkind: {{ .kind }}\n{{- range .ports }}\n- {{ .port }}\n{{- end }}\n" +
+			"tag: {{ .image.tag | default \"latest\" }}\n{{ include \"labels\" . }}\n"
+		partials := map[string]string{"labels": "app: {{ .name }}\nteam: {{ .team }}"}
+		values := map[string]interface{}{
+			"name":  "krateo",
+			"ports": []interface{}{map[string]interface{}{"name": "http"}},
+		}
+
+		err := renderGoTemplate("content", text, values, true, [2]string{}, partials, io.Discard)
+		var mve *missingVariablesError
+		require.ErrorAs(t, err, &mve)
+		assert.Equal(t, []missingVariable{
+			{Line: 2, Name: "kind"},
+			{Line: 4, Name: "port"},
+			{Line: 6, Name: "image.tag"},
+			{Line: 7, Name: "team (partial labels)"},
+		}, mve.vars)
+	})
+
+	t.Run("not strict", func(t *testing.T) {
+		co := newCopier(origin, target, "/skeleton", "/rendered")
+		createRenderFuncs(co, values, renderOpts{})
+
+		require.NoError(t, e.copyToTarget(co, true, "/skeleton", "/rendered"))
+		assert.Empty(t, co.missing)
+	})
+}
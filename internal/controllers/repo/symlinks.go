@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	symlinksSkip        = "skip"
+	symlinksPreserve    = "preserve"
+	symlinksDereference = "dereference"
+
+	// maxSymlinkHops is the maximum number of links followed to dereference a link, as linux does
+	maxSymlinkHops = 40
+)
+
+var ErrSymlinkLoop = errors.New("too many levels of symbolic links")
+
+// readLink returns the target of the link src. Absolute targets and targets outside of the origin repo or inside its
+// `.git` directory are rejected with an ErrPathTraversal error.
+func (co *copier) readLink(src string) (string, error) {
+	target, err := co.fromRepo.FS().Readlink(src)
+	if err != nil {
+		return "", fmt.Errorf("unable to read link %s: %w", src, err)
+	}
+	if filepath.IsAbs(target) || strings.HasPrefix(target, `\`) {
+		return "", fmt.Errorf("%w: link %s points to the absolute path %q", ErrPathTraversal, src, target)
+	}
+	if err := checkTargetPath(filepath.Join(relativeDir(src), target)); err != nil {
+		return "", fmt.Errorf("%w: link %s points to %q, outside of the origin repository", ErrPathTraversal, src, target)
+	}
+	return target, nil
+}
+
+// preserveSymlink recreates the link src at dst, the link must point inside both the origin and the target repos.
+func (co *copier) preserveSymlink(src, dst string) error {
+	target, err := co.readLink(src)
+	if err != nil {
+		return err
+	}
+	if err := checkTargetPath(filepath.Join(relativeDir(dst), target)); err != nil {
+		return fmt.Errorf("%w: link %s copied to %s points to %q, outside of the target repository", ErrPathTraversal, src, dst, target)
+	}
+
+	toFS := co.toRepo.FS()
+	if _, err := toFS.Lstat(dst); err == nil {
+		if err := toFS.Remove(dst); err != nil {
+			return fmt.Errorf("unable to replace %s with a link: %w", dst, err)
+		}
+	}
+	co.debug("Preserving link", "file", src, "target", target)
+	return toFS.Symlink(target, dst)
+}
+
+// copyDereferenced copies the file or the directory the link src points to at dst.
+func (co *copier) copyDereferenced(src, dst string, doNotRender bool) error {
+	resolved, fi, err := co.resolveSymlink(src)
+	if err != nil {
+		return err
+	}
+	co.debug("Dereferencing link", "file", src, "target", resolved)
+
+	if !fi.IsDir() {
+		if co.isProtected(dst) {
+			co.debug("Skipping protected path", "file", src, "target", dst)
+			co.protectedSkipped = append(co.protectedSkipped, dst)
+			return nil
+		}
+		return co.copyFile(resolved, dst, doNotRender)
+	}
+
+	// a link to an ancestor, or to a directory being dereferenced, would be copied forever
+	if isWithin(resolved, src) || co.dereferencing[resolved] {
+		return fmt.Errorf("%w: %s points to %s", ErrSymlinkLoop, src, resolved)
+	}
+	if co.dereferencing == nil {
+		co.dereferencing = map[string]bool{}
+	}
+	co.dereferencing[resolved] = true
+	defer delete(co.dereferencing, resolved)
+
+	return co.copyTree(resolved, dst)
+}
+
+// resolveSymlink follows the link src, and the links it points to, returning the final target in the origin repo.
+func (co *copier) resolveSymlink(src string) (string, os.FileInfo, error) {
+	fromFS := co.fromRepo.FS()
+
+	path := src
+	for i := 0; i < maxSymlinkHops; i++ {
+		target, err := co.readLink(path)
+		if err != nil {
+			return "", nil, err
+		}
+		path = filepath.Join(filepath.Dir(path), target)
+
+		// the parent directories are resolved by the filesystem, they must not be links
+		for dir := filepath.Dir(path); dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+			if fi, err := fromFS.Lstat(dir); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				return "", nil, fmt.Errorf("link %s points to %s, whose parent %s is a link", src, path, dir)
+			}
+		}
+
+		fi, err := fromFS.Lstat(path)
+		if err != nil {
+			return "", nil, fmt.Errorf("unable to resolve link %s: %w", src, err)
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return path, fi, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w: %s", ErrSymlinkLoop, src)
+}
+
+// relativeDir returns the directory of path, relative to the root.
+func relativeDir(path string) string {
+	return strings.TrimPrefix(filepath.Dir(filepath.Join("/", path)), "/")
+}
+
+// isWithin reports whether path is dir or one of its descendants.
+func isWithin(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopySymlinks(t *testing.T) {
+	baseRepo := git.BaseSuite{}
+	baseRepo.BuildBasicRepository()
+	url := baseRepo.GetBasicLocalRepositoryURL()
+
+	files := map[string]string{
+		"/skeleton/shared/Makefile":  "build: {{ name }}\n",
+		"/skeleton/shared/lib/a.txt": "a: {{ name }}\n",
+	}
+	links := map[string]string{
+		"/skeleton/app/Makefile": "../shared/Makefile",
+		"/skeleton/app/lib":      "../shared/lib",
+		"/skeleton/app/chained":  "Makefile",
+	}
+	values := map[string]interface{}{"name": "krateo"}
+
+	copyWith := func(t *testing.T, mode string, files, links map[string]string, toPath string) (*git.Repo, error) {
+		origin := newTestRepoWithLinks(t, url, files, links)
+		target := newTestRepoWithLinks(t, url, nil, nil)
+		co := newCopier(origin, target, "/skeleton", toPath)
+		co.symlinks = mode
+		createRenderFuncs(co, values, renderOpts{})
+		return target, co.copyDir("/skeleton", toPath)
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		target, err := copyWith(t, symlinksSkip, files, links, "/rendered")
+		require.NoError(t, err)
+		for _, name := range []string{"/rendered/app/Makefile", "/rendered/app/lib", "/rendered/app/chained"} {
+			_, err := target.FS().Lstat(name)
+			assert.True(t, os.IsNotExist(err), name)
+		}
+	})
+
+	t.Run("preserve", func(t *testing.T) {
+		target, err := copyWith(t, symlinksPreserve, files, links, "/rendered")
+		require.NoError(t, err)
+		for link, expected := range links {
+			name := strings.Replace(link, "/skeleton", "/rendered", 1)
+			fi, err := target.FS().Lstat(name)
+			require.NoError(t, err, name)
+			assert.NotZero(t, fi.Mode()&os.ModeSymlink, name)
+			got, err := target.FS().Readlink(name)
+			require.NoError(t, err)
+			assert.Equal(t, expected, got)
+		}
+		assert.Equal(t, "build: krateo\n", readTestFile(t, target, "/rendered/app/Makefile"))
+	})
+
+	t.Run("dereference", func(t *testing.T) {
+		target, err := copyWith(t, symlinksDereference, files, links, "/rendered")
+		require.NoError(t, err)
+		for _, name := range []string{"/rendered/app/Makefile", "/rendered/app/chained", "/rendered/app/lib/a.txt"} {
+			fi, err := target.FS().Lstat(name)
+			require.NoError(t, err, name)
+			assert.Zero(t, fi.Mode()&os.ModeSymlink, name)
+		}
+		assert.Equal(t, "build: krateo\n", readTestFile(t, target, "/rendered/app/chained"))
+		assert.Equal(t, "a: krateo\n", readTestFile(t, target, "/rendered/app/lib/a.txt"))
+	})
+
+	both := []string{symlinksPreserve, symlinksDereference}
+	rejected := []struct {
+		name   string
+		modes  []string
+		links  map[string]string
+		toPath string
+	}{
+		{name: "absolute", modes: both, links: map[string]string{"/skeleton/passwd": "/etc/passwd"}},
+		{name: "outside of the origin repo", modes: both, links: map[string]string{"/skeleton/passwd": "../../../../etc/passwd"}},
+		{name: "into .git", modes: both, links: map[string]string{"/skeleton/config": "../.git/config"}},
+		// dereferenced links are copied as files, so they cannot point outside of the target repo
+		{name: "outside of the target repo", modes: []string{symlinksPreserve}, links: map[string]string{"/skeleton/readme": "../README"}, toPath: "/"},
+	}
+	for _, tt := range rejected {
+		for _, mode := range tt.modes {
+			t.Run(mode+" "+tt.name, func(t *testing.T) {
+				toPath := tt.toPath
+				if toPath == "" {
+					toPath = "/rendered"
+				}
+				_, err := copyWith(t, mode, map[string]string{"/README": "readme\n"}, tt.links, toPath)
+				assert.ErrorIs(t, err, ErrPathTraversal)
+			})
+		}
+	}
+
+	t.Run("dereference loops", func(t *testing.T) {
+		for _, links := range []map[string]string{
+			{"/skeleton/app/self": ".."},
+			{"/skeleton/a": "b", "/skeleton/b": "a"},
+			{"/skeleton/x/link": "../y", "/skeleton/y/link": "../x"},
+		} {
+			_, err := copyWith(t, symlinksDereference, nil, links, "/rendered")
+			assert.ErrorIs(t, err, ErrSymlinkLoop, links)
+		}
+	})
+}
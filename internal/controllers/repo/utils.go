@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"path"
 	"path/filepath"
 	"strings"
 
 	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/git-provider/internal/clients/git"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/cbroglie/mustache"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-git/v5/plumbing/transport"
@@ -25,6 +28,7 @@ type externalClientOpts struct {
 	ToRepoCreds             transport.AuthMethod
 	FromRepoCookieFile      []byte
 	ToRepoCookieFile        []byte
+	ToRepoSigner            git.Signer
 }
 
 func loadExternalClientOpts(ctx context.Context, kc client.Client, cr *repov1alpha1.Repo) (*externalClientOpts, error) {
@@ -41,17 +45,22 @@ func loadExternalClientOpts(ctx context.Context, kc client.Client, cr *repov1alp
 		}
 	}
 
-	toRepoCreds, err := getRepoCredentials(ctx, kc, cr.Spec.ToRepo)
+	toRepoCreds, err := getRepoCredentials(ctx, kc, cr.Spec.ToRepo.RepoOpts)
 	if err != nil {
 		return nil, fmt.Errorf("retrieving .toRepo credentials: %w", err)
 	}
 	if toRepoCreds == nil {
-		toRepoCookie, err = getRepoCookies(ctx, kc, cr.Spec.ToRepo)
+		toRepoCookie, err = getRepoCookies(ctx, kc, cr.Spec.ToRepo.RepoOpts)
 		if err != nil {
 			return nil, fmt.Errorf("retrieving .toRepo cookies: %w", err)
 		}
 	}
 
+	toRepoSigner, err := getRepoSigner(ctx, kc, cr.Spec.ToRepo.SigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving .toRepo signing key: %w", err)
+	}
+
 	return &externalClientOpts{
 		Insecure:                cr.Spec.Insecure,
 		UnsupportedCapabilities: cr.Spec.UnsupportedCapabilities,
@@ -59,9 +68,36 @@ func loadExternalClientOpts(ctx context.Context, kc client.Client, cr *repov1alp
 		ToRepoCreds:             toRepoCreds,
 		FromRepoCookieFile:      fromRepoCookie,
 		ToRepoCookieFile:        toRepoCookie,
+		ToRepoSigner:            toRepoSigner,
 	}, nil
 }
 
+// getRepoSigner returns the commit signer built from the private key stored in a secret.
+func getRepoSigner(ctx context.Context, k client.Client, opts *repov1alpha1.SigningKeyOpts) (git.Signer, error) {
+	if opts == nil || opts.SecretRef == nil {
+		return nil, nil
+	}
+
+	key, err := resource.GetSecret(ctx, k, opts.SecretRef)
+	if err != nil {
+		return nil, err
+	}
+
+	var passphrase string
+	if opts.PassphraseRef != nil {
+		passphrase, err = resource.GetSecret(ctx, k, opts.PassphraseRef)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.EqualFold(opts.Format, "ssh") {
+		return git.NewSSHSigner([]byte(key), []byte(passphrase))
+	}
+
+	return git.NewOpenPGPSigner([]byte(key), []byte(passphrase))
+}
+
 func getRepoCookies(ctx context.Context, k client.Client, opts repov1alpha1.RepoOpts) ([]byte, error) {
 	if opts.SecretRef == nil {
 		return nil, nil
@@ -107,24 +143,164 @@ func getRepoCredentials(ctx context.Context, k client.Client, opts repov1alpha1.
 	}, nil
 }
 
-func createRenderFuncs(co *copier, values interface{}) {
-	co.renderFunc = func(in io.Reader, out io.Writer) error {
+// pushOptFor returns the push options matching the `toRepo.pushMode` and `toRepo.historyMode`.
+func pushOptFor(opts repov1alpha1.ToRepoOpts, targetCommitId string) *git.PushOpt {
+	switch {
+	case strings.EqualFold(opts.PushMode, "force"):
+		return &git.PushOpt{Force: true}
+	case strings.EqualFold(opts.PushMode, "forceWithLease"), isSquash(opts):
+		return &git.PushOpt{Force: true, WithLease: true, Lease: targetCommitId}
+	default:
+		return nil
+	}
+}
+
+// isSquash reports whether the target branch history must be squashed to a single commit.
+func isSquash(opts repov1alpha1.ToRepoOpts) bool {
+	return strings.EqualFold(opts.HistoryMode, "squash")
+}
+
+// renderOpts configures the render functions of a copier.
+type renderOpts struct {
+	// engine is the template engine, `mustache` (default) or `gotemplate`
+	engine string
+	// strict makes the render functions fail on unresolved variables with a missingVariablesError
+	strict bool
+	// pathDelimiters are the left and right delimiters of directory and file names, the engine ones if empty
+	pathDelimiters [2]string
+	// delimiters are the content delimiters by glob, the first matching one applies
+	delimiters []globDelimiters
+	// partials provides the partials of the origin repo, none if nil
+	partials *partialsProvider
+}
+
+// newRenderOpts returns the render options of the spec.
+func newRenderOpts(spec *repov1alpha1.RepoSpec) renderOpts {
+	opts := renderOpts{
+		engine: spec.TemplateEngine,
+		strict: spec.StrictTemplating,
+	}
+	if spec.PathTemplating != nil {
+		opts.pathDelimiters = parseDelimiters(spec.PathTemplating.Delimiters)
+	}
+	for _, d := range spec.Delimiters {
+		opts.delimiters = append(opts.delimiters, globDelimiters{
+			paths:      d.Paths,
+			delimiters: parseDelimiters(d.Delimiters),
+		})
+	}
+	return opts
+}
+
+// globDelimiters are the delimiters of the files matching any of the paths globs.
+type globDelimiters struct {
+	paths      []string
+	delimiters [2]string
+}
+
+// parseDelimiters parses the left and right delimiters separated by a space, they are empty if s is not valid.
+func parseDelimiters(s string) [2]string {
+	if delims := strings.Fields(s); len(delims) == 2 {
+		return [2]string{delims[0], delims[1]}
+	}
+	return [2]string{}
+}
+
+// delimitersFor returns the content delimiters of src, which is relative to the origin path; they are empty if no glob matches.
+func (opts renderOpts) delimitersFor(src string) [2]string {
+	src = strings.TrimPrefix(filepath.ToSlash(src), "/")
+	for _, d := range opts.delimiters {
+		for _, p := range d.paths {
+			p = strings.TrimPrefix(p, "/")
+			name := src
+			if !strings.Contains(p, "/") {
+				name = path.Base(src)
+			}
+			if ok, _ := doublestar.Match(p, name); ok {
+				return d.delimiters
+			}
+		}
+	}
+	return [2]string{}
+}
+
+// withMustacheDelimiters prefixes text with a set delimiter tag, if delims are not empty nor the default ones.
+func withMustacheDelimiters(text string, delims [2]string) string {
+	if delims[0] == "" || delims == [2]string{"{{", "}}"} {
+		return text
+	}
+	return fmt.Sprintf("{{=%s %s=}}%s", delims[0], delims[1], text)
+}
+
+// createRenderFuncs sets the copier render functions for file contents and for directory and file names.
+func createRenderFuncs(co *copier, values interface{}, opts renderOpts) {
+	// relative returns the path of src relative to the origin path, used to match the delimiters globs
+	relative := func(src string) string {
+		if rel, err := filepath.Rel(co.originCopyPath, src); err == nil {
+			return rel
+		}
+		return src
+	}
+
+	if strings.EqualFold(opts.engine, "gotemplate") {
+		var partials map[string]string
+		co.renderFunc = func(src string, in io.Reader, out io.Writer) error {
+			bin, err := io.ReadAll(in)
+			if err != nil {
+				return err
+			}
+			// partials are loaded once, on the first rendered file
+			if partials == nil {
+				if partials, err = opts.partials.All(); err != nil {
+					return err
+				}
+			}
+			return renderGoTemplate("content", string(bin), values, opts.strict, opts.delimitersFor(relative(src)), partials, out)
+		}
+		co.renderFileNames = func(src string) (string, error) {
+			var b strings.Builder
+			if err := renderGoTemplate("filename", src, values, opts.strict, opts.pathDelimiters, nil, &b); err != nil {
+				return "", err
+			}
+			return b.String(), nil
+		}
+		return
+	}
+
+	co.renderFunc = func(src string, in io.Reader, out io.Writer) error {
 		bin, err := io.ReadAll(in)
 		if err != nil {
 			return err
 		}
-		tmpl, err := mustache.ParseString(string(bin))
+		// a set delimiter tag at the beginning of the file overrides the configured delimiters
+		text := string(bin)
+		if !strings.HasPrefix(text, "{{=") {
+			text = withMustacheDelimiters(text, opts.delimitersFor(relative(src)))
+		}
+		tmpl, err := mustache.ParseStringPartials(text, opts.partials)
 		if err != nil {
 			return err
 		}
+		if opts.strict {
+			if missing := findMissingMustacheVariables(text, values, opts.partials); len(missing) > 0 {
+				return &missingVariablesError{vars: missing}
+			}
+		}
 
 		return tmpl.FRender(out, values)
 	}
 	co.renderFileNames = func(src string) (string, error) {
+		// names cannot start with a set delimiter tag, custom delimiters are set here
+		src = withMustacheDelimiters(src, opts.pathDelimiters)
 		tmpl, err := mustache.ParseString(src)
 		if err != nil {
 			return "", err
 		}
+		if opts.strict {
+			if missing := findMissingMustacheVariables(src, values, nil); len(missing) > 0 {
+				return "", &missingVariablesError{vars: missing}
+			}
+		}
 		return tmpl.Render(values)
 	}
 
@@ -2,7 +2,11 @@ package repo
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/go-git/go-billy/v5/memfs"
@@ -13,6 +17,7 @@ import (
 	gi "github.com/sabhiram/go-gitignore"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -38,13 +43,15 @@ func TestLoadExternalClientOpts(t *testing.T) {
 					},
 				},
 			},
-			ToRepo: repov1alpha1.RepoOpts{
-				AuthMethod: "generic",
-				SecretRef: &commonv1.SecretKeySelector{
-					Key: "token",
-					Reference: commonv1.Reference{
-						Name:      "to-repo-secret",
-						Namespace: "default",
+			ToRepo: repov1alpha1.ToRepoOpts{
+				RepoOpts: repov1alpha1.RepoOpts{
+					AuthMethod: "generic",
+					SecretRef: &commonv1.SecretKeySelector{
+						Key: "token",
+						Reference: commonv1.Reference{
+							Name:      "to-repo-secret",
+							Namespace: "default",
+						},
 					},
 				},
 			},
@@ -202,3 +209,124 @@ func TestLoadFilesIntoArray(t *testing.T) {
 
 	assert.ElementsMatch(t, expectedFiles, flist)
 }
+
+func TestGetRepoSigner(t *testing.T) {
+	ctx := context.TODO()
+	kc := fake.NewFakeClient()
+
+	signer, err := getRepoSigner(ctx, kc, nil)
+	require.NoError(t, err)
+	assert.Nil(t, signer)
+
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(privKey, "", []byte("secret"))
+	require.NoError(t, err)
+
+	require.NoError(t, kc.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "signing-key",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			"key":        pem.EncodeToMemory(block),
+			"passphrase": []byte("secret"),
+		},
+	}))
+
+	opts := &repov1alpha1.SigningKeyOpts{
+		Format: "ssh",
+		SecretRef: &commonv1.SecretKeySelector{
+			Key: "key",
+			Reference: commonv1.Reference{
+				Name:      "signing-key",
+				Namespace: "default",
+			},
+		},
+	}
+
+	_, err = getRepoSigner(ctx, kc, opts)
+	assert.ErrorIs(t, err, git.ErrSigningKeyLocked)
+
+	opts.PassphraseRef = &commonv1.SecretKeySelector{
+		Key: "passphrase",
+		Reference: commonv1.Reference{
+			Name:      "signing-key",
+			Namespace: "default",
+		},
+	}
+	signer, err = getRepoSigner(ctx, kc, opts)
+	require.NoError(t, err)
+	assert.NotNil(t, signer)
+}
+
+func TestPushOptFor(t *testing.T) {
+	assert.Nil(t, pushOptFor(repov1alpha1.ToRepoOpts{}, "abc"))
+	assert.Nil(t, pushOptFor(repov1alpha1.ToRepoOpts{PushMode: "fastForwardOnly", HistoryMode: "append"}, "abc"))
+	assert.Equal(t, &git.PushOpt{Force: true}, pushOptFor(repov1alpha1.ToRepoOpts{PushMode: "force"}, "abc"))
+	assert.Equal(t, &git.PushOpt{Force: true, WithLease: true, Lease: "abc"}, pushOptFor(repov1alpha1.ToRepoOpts{PushMode: "forceWithLease"}, "abc"))
+	assert.Equal(t, &git.PushOpt{Force: true, WithLease: true, Lease: "abc"}, pushOptFor(repov1alpha1.ToRepoOpts{HistoryMode: "squash"}, "abc"))
+	assert.Equal(t, &git.PushOpt{Force: true}, pushOptFor(repov1alpha1.ToRepoOpts{PushMode: "force", HistoryMode: "squash"}, "abc"))
+}
+
+func TestContentDelimiters(t *testing.T) {
+	spec := &repov1alpha1.RepoSpec{
+		Delimiters: []repov1alpha1.DelimitersOpts{
+			{Paths: []string{"charts/**/*.yaml"}, Delimiters: "<% %>"},
+			{Paths: []string{"*.yaml", "*.yml"}, Delimiters: "[[ ]]"},
+		},
+	}
+	values := map[string]interface{}{"name": "krateo"}
+
+	tests := []struct {
+		name     string
+		engine   string
+		src      string
+		template string
+		expected string
+	}{
+		{
+			name:     "first matching glob",
+			src:      "/skeleton/charts/app/values.yaml",
+			template: "name: <% name %>\nraw: {{ name }} [[ name ]]",
+			expected: "name: krateo\nraw: {{ name }} [[ name ]]",
+		},
+		{
+			name:     "file name glob in any directory",
+			src:      "/skeleton/deploy/app.yml",
+			template: "name: [[ name ]]\nraw: {{ name }}",
+			expected: "name: krateo\nraw: {{ name }}",
+		},
+		{
+			name:     "no matching glob",
+			src:      "/skeleton/main.go",
+			template: "name: {{ name }}",
+			expected: "name: krateo",
+		},
+		{
+			name:     "set delimiter tag in the file",
+			src:      "/skeleton/app.yaml",
+			template: "{{=<% %>=}}name: <% name %>",
+			expected: "name: krateo",
+		},
+		{
+			name:     "gotemplate",
+			engine:   "gotemplate",
+			src:      "/skeleton/app.yaml",
+			template: "name: [[ .name ]]\nraw: {{ .name }}",
+			expected: "name: krateo\nraw: {{ .name }}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec.TemplateEngine = tt.engine
+			co := &copier{originCopyPath: "/skeleton"}
+			createRenderFuncs(co, values, newRenderOpts(spec))
+
+			var out strings.Builder
+			require.NoError(t, co.renderFunc(tt.src, strings.NewReader(tt.template), &out))
+			assert.Equal(t, tt.expected, out.String())
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/provider-runtime/pkg/resource"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// valuesRefIndex indexes the Repos by the ConfigMaps and Secrets they load template values from.
+	valuesRefIndex = "spec.valuesRefs"
+
+	valuesRefConfigMap = "configmap"
+	valuesRefSecret    = "secret"
+)
+
+func valuesRefKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// valuesRefs returns the index keys of the ConfigMaps and Secrets referenced as sources of template values.
+func valuesRefs(spec *repov1alpha1.RepoSpec) []string {
+	var res []string
+	if ref := spec.ConfigMapKeyRef; ref != nil {
+		res = append(res, valuesRefKey(valuesRefConfigMap, ref.Namespace, ref.Name))
+	}
+	for _, src := range spec.ValuesFrom {
+		if ref := src.ConfigMapKeyRef; ref != nil {
+			res = append(res, valuesRefKey(valuesRefConfigMap, ref.Namespace, ref.Name))
+		}
+		if ref := src.SecretKeyRef; ref != nil {
+			res = append(res, valuesRefKey(valuesRefSecret, ref.Namespace, ref.Name))
+		}
+	}
+	return res
+}
+
+/*
+loadValues loads the template values from all the sources of the spec and deep-merges them in order of precedence (lowest first):
+  - spec.configMapKeyRef
+  - spec.valuesFrom, in the order they are listed
+  - spec.values
+
+It returns nil if no source is set.
+*/
+func (e *external) loadValues(ctx context.Context, spec *repov1alpha1.RepoSpec) (map[string]interface{}, error) {
+	var res map[string]interface{}
+
+	if spec.ConfigMapKeyRef != nil {
+		values, err := e.loadValuesFromConfigMap(ctx, spec.ConfigMapKeyRef)
+		if err != nil {
+			return nil, fmt.Errorf("configmap %s/%s key %s: %w", spec.ConfigMapKeyRef.Namespace, spec.ConfigMapKeyRef.Name, spec.ConfigMapKeyRef.Key, err)
+		}
+		res = mergeValues(res, values)
+	}
+
+	for i, src := range spec.ValuesFrom {
+		var (
+			data string
+			err  error
+		)
+		switch {
+		case src.ConfigMapKeyRef != nil && src.SecretKeyRef != nil:
+			err = fmt.Errorf("both configMapKeyRef and secretKeyRef set")
+		case src.ConfigMapKeyRef != nil:
+			data, err = resource.GetConfigMapValue(ctx, e.kube, src.ConfigMapKeyRef)
+		case src.SecretKeyRef != nil:
+			data, err = resource.GetSecret(ctx, e.kube, src.SecretKeyRef)
+		default:
+			err = fmt.Errorf("no source set")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("valuesFrom[%d]: %w", i, err)
+		}
+
+		values, err := parseValues(data)
+		if err != nil {
+			return nil, fmt.Errorf("valuesFrom[%d]: %w", i, err)
+		}
+		res = mergeValues(res, values)
+	}
+
+	if spec.Values != nil && len(spec.Values.Raw) > 0 {
+		values, err := parseValues(string(spec.Values.Raw))
+		if err != nil {
+			return nil, fmt.Errorf("values: %w", err)
+		}
+		res = mergeValues(res, values)
+	}
+
+	return res, nil
+}
+
+// parseValues parses JSON or YAML values.
+func parseValues(data string) (map[string]interface{}, error) {
+	var res map[string]interface{}
+
+	data = strings.TrimPrefix(data, "'")
+	data = strings.TrimSuffix(data, "'")
+
+	if err := yaml.Unmarshal([]byte(data), &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// mergeValues deep-merges src into dst: nested maps are merged, any other value of src replaces the one of dst.
+func mergeValues(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		dst = make(map[string]interface{}, len(src))
+	}
+	for k, v := range src {
+		srcMap, srcOk := v.(map[string]interface{})
+		dstMap, dstOk := dst[k].(map[string]interface{})
+		if srcOk && dstOk {
+			dst[k] = mergeValues(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// valuesHash returns the SHA-256 of the canonical JSON encoding of the values, or an empty string if values is nil.
+func valuesHash(values map[string]interface{}) (string, error) {
+	if values == nil {
+		return "", nil
+	}
+	// json.Marshal sorts map keys, so the encoding does not depend on the merge order
+	bin, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bin)
+	return hex.EncodeToString(sum[:]), nil
+}
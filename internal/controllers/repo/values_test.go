@@ -0,0 +1,188 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	commonv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestLoadValues(t *testing.T) {
+	ctx := context.TODO()
+	kc := fake.NewFakeClient(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "values", Namespace: "default"},
+			Data: map[string]string{
+				"json": `'{"name": "krateo", "service": {"type": "ClusterIP", "port": 80}}'`,
+				"yaml": "service:\n  port: 8080\nreplicas: 2\n",
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+			Data: map[string][]byte{
+				"values": []byte("credentials:\n  token: s3cr3t\n"),
+			},
+		},
+	)
+	e := &external{kube: kc}
+
+	spec := &repov1alpha1.RepoSpec{
+		ConfigMapKeyRef: &commonv1.ConfigMapKeySelector{
+			Key: "json",
+			Reference: commonv1.Reference{
+				Name:      "values",
+				Namespace: "default",
+			},
+		},
+		ValuesFrom: []repov1alpha1.ValuesSource{
+			{
+				ConfigMapKeyRef: &commonv1.ConfigMapKeySelector{
+					Key: "yaml",
+					Reference: commonv1.Reference{
+						Name:      "values",
+						Namespace: "default",
+					},
+				},
+			},
+			{
+				SecretKeyRef: &commonv1.SecretKeySelector{
+					Key: "values",
+					Reference: commonv1.Reference{
+						Name:      "credentials",
+						Namespace: "default",
+					},
+				},
+			},
+		},
+		Values: &runtime.RawExtension{Raw: []byte(`{"replicas": 3}`)},
+	}
+
+	values, err := e.loadValues(ctx, spec)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name": "krateo",
+		"service": map[string]interface{}{
+			"type": "ClusterIP",
+			"port": float64(8080),
+		},
+		"replicas": float64(3),
+		"credentials": map[string]interface{}{
+			"token": "s3cr3t",
+		},
+	}, values)
+
+	spec.ValuesFrom = append(spec.ValuesFrom, repov1alpha1.ValuesSource{
+		ConfigMapKeyRef: &commonv1.ConfigMapKeySelector{
+			Key: "values",
+			Reference: commonv1.Reference{
+				Name:      "missing",
+				Namespace: "default",
+			},
+		},
+	})
+	_, err = e.loadValues(ctx, spec)
+	assert.ErrorContains(t, err, "valuesFrom[2]")
+
+	spec.ValuesFrom[2] = repov1alpha1.ValuesSource{}
+	_, err = e.loadValues(ctx, spec)
+	assert.ErrorContains(t, err, "valuesFrom[2]: no source set")
+
+	spec.ValuesFrom[2] = repov1alpha1.ValuesSource{
+		ConfigMapKeyRef: spec.ValuesFrom[0].ConfigMapKeyRef,
+		SecretKeyRef:    spec.ValuesFrom[1].SecretKeyRef,
+	}
+	_, err = e.loadValues(ctx, spec)
+	assert.ErrorContains(t, err, "valuesFrom[2]: both configMapKeyRef and secretKeyRef set")
+
+	values, err = e.loadValues(ctx, &repov1alpha1.RepoSpec{})
+	require.NoError(t, err)
+	assert.Nil(t, values)
+}
+
+func TestValuesHash(t *testing.T) {
+	hash, err := valuesHash(nil)
+	require.NoError(t, err)
+	assert.Empty(t, hash)
+
+	a, err := valuesHash(mergeValues(
+		map[string]interface{}{"a": 1, "nested": map[string]interface{}{"x": 1}},
+		map[string]interface{}{"b": 2, "nested": map[string]interface{}{"y": 2}},
+	))
+	require.NoError(t, err)
+	b, err := valuesHash(map[string]interface{}{"b": 2, "a": 1, "nested": map[string]interface{}{"y": 2, "x": 1}})
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+
+	c, err := valuesHash(map[string]interface{}{"a": 1})
+	require.NoError(t, err)
+	assert.NotEqual(t, a, c)
+}
+
+func TestEnqueueReposReferencing(t *testing.T) {
+	ctx := context.TODO()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, repov1alpha1.SchemeBuilder.AddToScheme(scheme))
+
+	referencing := &repov1alpha1.Repo{
+		ObjectMeta: metav1.ObjectMeta{Name: "referencing", Namespace: "default"},
+		Spec: repov1alpha1.RepoSpec{
+			ValuesFrom: []repov1alpha1.ValuesSource{
+				{
+					SecretKeyRef: &commonv1.SecretKeySelector{
+						Key: "values",
+						Reference: commonv1.Reference{
+							Name:      "credentials",
+							Namespace: "default",
+						},
+					},
+				},
+			},
+		},
+	}
+	other := &repov1alpha1.Repo{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"},
+		Spec: repov1alpha1.RepoSpec{
+			ConfigMapKeyRef: &commonv1.ConfigMapKeySelector{
+				Key: "values",
+				Reference: commonv1.Reference{
+					Name:      "credentials",
+					Namespace: "default",
+				},
+			},
+		},
+	}
+
+	kc := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(referencing, other).
+		WithIndex(&repov1alpha1.Repo{}, valuesRefIndex, func(obj client.Object) []string {
+			return valuesRefs(&obj.(*repov1alpha1.Repo).Spec)
+		}).
+		Build()
+
+	// the watches deliver only the metadata of the objects
+	secret := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"}}
+	secret.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+	reqs := enqueueReposReferencing(kc, valuesRefSecret)(ctx, secret)
+	assert.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "default", Name: "referencing"}},
+	}, reqs)
+
+	configMap := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"}}
+	configMap.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	reqs = enqueueReposReferencing(kc, valuesRefConfigMap)(ctx, configMap)
+	assert.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "default", Name: "other"}},
+	}, reqs)
+}
@@ -0,0 +1,253 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown webhook provider")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrUnsupportedEvent = errors.New("unsupported webhook event")
+)
+
+const (
+	ProviderGitHub    = "github"
+	ProviderGitLab    = "gitlab"
+	ProviderGitea     = "gitea"
+	ProviderBitbucket = "bitbucket"
+)
+
+// Push is a push event received from a git server.
+type Push struct {
+	Provider string
+	// URLs are the urls of the pushed repository (https, ssh and web), as sent by the git server.
+	URLs []string
+	// Branches are the names of the pushed branches.
+	Branches []string
+}
+
+/*
+ParsePush verifies the signature of a push webhook and parses its payload. The provider is detected from the headers:
+  - GitHub: `X-GitHub-Event`, signed with `X-Hub-Signature-256`
+  - GitLab: `X-Gitlab-Event`, authenticated with `X-Gitlab-Token`
+  - Gitea: `X-Gitea-Event`, signed with `X-Gitea-Signature`
+  - Bitbucket Cloud and Data Center: `X-Event-Key`, signed with `X-Hub-Signature`
+
+Events other than pushes, once authenticated, return ErrUnsupportedEvent.
+*/
+func ParsePush(h http.Header, body []byte, secret []byte) (*Push, error) {
+	switch {
+	// Gitea also sends the GitHub headers, so it is detected first
+	case h.Get("X-Gitea-Event") != "":
+		if err := verifyHMAC(h.Get("X-Gitea-Signature"), "", body, secret); err != nil {
+			return nil, err
+		}
+		if event := h.Get("X-Gitea-Event"); event != "push" {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedEvent, event)
+		}
+		return parseGitHubPush(ProviderGitea, body)
+
+	case h.Get("X-GitHub-Event") != "":
+		if err := verifyHMAC(h.Get("X-Hub-Signature-256"), "sha256=", body, secret); err != nil {
+			return nil, err
+		}
+		if event := h.Get("X-GitHub-Event"); event != "push" {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedEvent, event)
+		}
+		return parseGitHubPush(ProviderGitHub, body)
+
+	case h.Get("X-Gitlab-Event") != "":
+		if subtle.ConstantTimeCompare([]byte(h.Get("X-Gitlab-Token")), secret) != 1 {
+			return nil, ErrInvalidSignature
+		}
+		if event := h.Get("X-Gitlab-Event"); event != "Push Hook" {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedEvent, event)
+		}
+		return parseGitLabPush(body)
+
+	case h.Get("X-Event-Key") != "":
+		if err := verifyHMAC(h.Get("X-Hub-Signature"), "sha256=", body, secret); err != nil {
+			return nil, err
+		}
+		switch event := h.Get("X-Event-Key"); event {
+		case "repo:push":
+			return parseBitbucketCloudPush(body)
+		case "repo:refs_changed":
+			return parseBitbucketServerPush(body)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedEvent, event)
+		}
+	}
+	return nil, ErrUnknownProvider
+}
+
+// verifyHMAC checks that signature is the hex encoded HMAC-SHA256 of body, after prefix.
+func verifyHMAC(signature, prefix string, body, secret []byte) error {
+	if !strings.HasPrefix(signature, prefix) {
+		return ErrInvalidSignature
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, prefix))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func parseGitHubPush(provider string, body []byte) (*Push, error) {
+	var payload struct {
+		Ref        string `json:"ref"`
+		Repository struct {
+			CloneURL string `json:"clone_url"`
+			SSHURL   string `json:"ssh_url"`
+			HTMLURL  string `json:"html_url"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid %s push payload: %w", provider, err)
+	}
+	return newPush(provider, []string{branchName(payload.Ref)},
+		payload.Repository.CloneURL, payload.Repository.SSHURL, payload.Repository.HTMLURL), nil
+}
+
+func parseGitLabPush(body []byte) (*Push, error) {
+	var payload struct {
+		Ref     string `json:"ref"`
+		Project struct {
+			HTTPURL string `json:"git_http_url"`
+			SSHURL  string `json:"git_ssh_url"`
+			WebURL  string `json:"web_url"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid gitlab push payload: %w", err)
+	}
+	return newPush(ProviderGitLab, []string{branchName(payload.Ref)},
+		payload.Project.HTTPURL, payload.Project.SSHURL, payload.Project.WebURL), nil
+}
+
+func parseBitbucketCloudPush(body []byte) (*Push, error) {
+	var payload struct {
+		Repository struct {
+			Links struct {
+				HTML struct {
+					Href string `json:"href"`
+				} `json:"html"`
+			} `json:"links"`
+		} `json:"repository"`
+		Push struct {
+			Changes []struct {
+				New *struct {
+					Type string `json:"type"`
+					Name string `json:"name"`
+				} `json:"new"`
+			} `json:"changes"`
+		} `json:"push"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid bitbucket push payload: %w", err)
+	}
+	var branches []string
+	for _, ch := range payload.Push.Changes {
+		// new is null when the branch is deleted
+		if ch.New != nil && ch.New.Type == "branch" {
+			branches = append(branches, ch.New.Name)
+		}
+	}
+	return newPush(ProviderBitbucket, branches, payload.Repository.Links.HTML.Href), nil
+}
+
+func parseBitbucketServerPush(body []byte) (*Push, error) {
+	var payload struct {
+		Repository struct {
+			Links struct {
+				Clone []struct {
+					Href string `json:"href"`
+				} `json:"clone"`
+			} `json:"links"`
+		} `json:"repository"`
+		Changes []struct {
+			Ref struct {
+				ID   string `json:"id"`
+				Type string `json:"type"`
+			} `json:"ref"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid bitbucket push payload: %w", err)
+	}
+	var branches []string
+	for _, ch := range payload.Changes {
+		if ch.Ref.Type == "BRANCH" {
+			branches = append(branches, branchName(ch.Ref.ID))
+		}
+	}
+	var urls []string
+	for _, l := range payload.Repository.Links.Clone {
+		urls = append(urls, l.Href)
+	}
+	return newPush(ProviderBitbucket, branches, urls...), nil
+}
+
+func newPush(provider string, branches []string, urls ...string) *Push {
+	res := &Push{Provider: provider}
+	for _, u := range urls {
+		if u != "" {
+			res.URLs = append(res.URLs, u)
+		}
+	}
+	for _, b := range branches {
+		if b != "" {
+			res.Branches = append(res.Branches, b)
+		}
+	}
+	return res
+}
+
+// branchName returns the name of the branch of a ref, or an empty string if ref is not a branch (e.g. a tag).
+func branchName(ref string) string {
+	name, ok := strings.CutPrefix(ref, "refs/heads/")
+	if !ok {
+		return ""
+	}
+	return name
+}
+
+/*
+NormalizeURL returns a canonical form of a repository url, so that the https, ssh and web urls of the same repository
+are equal: `https://user@GitHub.com/org/repo.git`, `git@github.com:org/repo` and `ssh://git@github.com:22/org/repo/`
+are all normalized to `github.com/org/repo`.
+*/
+func NormalizeURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	var host, path string
+	if !strings.Contains(raw, "://") {
+		// scp-like syntax: [user@]host:path
+		host, path, _ = strings.Cut(raw, ":")
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+	} else {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return strings.ToLower(raw)
+		}
+		host, path = u.Hostname(), u.Path
+	}
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	return strings.ToLower(host + "/" + path)
+}
@@ -0,0 +1,166 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	// FromRepoURLIndex indexes the Repos by the normalized url of their origin repo.
+	FromRepoURLIndex = "spec.fromRepo.url"
+
+	// Path is the path the webhooks are sent to.
+	Path = "/webhook"
+
+	maxBodySize = 10 << 20
+)
+
+// Server receives the push webhooks of the git servers and triggers the reconciliation of the Repos whose origin
+// repo and branch were pushed.
+type Server struct {
+	address string
+	secret  []byte
+	kube    client.Client
+	log     logging.Logger
+	events  chan event.GenericEvent
+}
+
+// NewServer returns a Server listening on address, and indexes the Repos by origin repo url in the manager cache.
+func NewServer(mgr ctrl.Manager, log logging.Logger, address, secret string) (*Server, error) {
+	if secret == "" {
+		return nil, errors.New("a webhook secret is required")
+	}
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &repov1alpha1.Repo{}, FromRepoURLIndex, IndexFromRepoURL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot index repos by origin repo url: %w", err)
+	}
+	return &Server{
+		address: address,
+		secret:  []byte(secret),
+		kube:    mgr.GetClient(),
+		log:     log.WithValues("component", "webhook"),
+		events:  make(chan event.GenericEvent, 100),
+	}, nil
+}
+
+// IndexFromRepoURL is the index function of FromRepoURLIndex.
+func IndexFromRepoURL(obj client.Object) []string {
+	cr, ok := obj.(*repov1alpha1.Repo)
+	if !ok || cr.Spec.FromRepo.Url == "" {
+		return nil
+	}
+	return []string{NormalizeURL(cr.Spec.FromRepo.Url)}
+}
+
+// Events returns the channel of the Repos to reconcile, to be watched by the controller.
+func (s *Server) Events() <-chan event.GenericEvent {
+	return s.events
+}
+
+// Start runs the server until ctx is done, it implements manager.Runnable.
+func (s *Server) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, s)
+
+	srv := &http.Server{
+		Addr:              s.address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	s.log.Info("Starting webhook server", "address", s.address, "path", Path)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	push, err := ParsePush(r.Header, body, s.secret)
+	switch {
+	case errors.Is(err, ErrInvalidSignature):
+		s.log.Info("Webhook rejected", "msg", err.Error(), "remoteAddr", r.RemoteAddr)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, ErrUnsupportedEvent):
+		s.log.Debug("Webhook ignored", "msg", err.Error())
+		w.WriteHeader(http.StatusAccepted)
+		return
+	case err != nil:
+		s.log.Info("Invalid webhook", "msg", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repos, err := s.match(r.Context(), push)
+	if err != nil {
+		s.log.Info("Unable to list repos matching the webhook", "msg", err.Error())
+		http.Error(w, "unable to list repos", http.StatusInternalServerError)
+		return
+	}
+	for i := range repos {
+		select {
+		case s.events <- event.GenericEvent{Object: &repos[i]}:
+		case <-r.Context().Done():
+			http.Error(w, "request canceled", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	s.log.Debug("Webhook received", "provider", push.Provider, "urls", push.URLs, "branches", push.Branches, "repos", len(repos))
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "%d repos enqueued\n", len(repos))
+}
+
+// match returns the Repos whose origin repo and branch were pushed.
+func (s *Server) match(ctx context.Context, push *Push) ([]repov1alpha1.Repo, error) {
+	var (
+		res  []repov1alpha1.Repo
+		seen []string
+	)
+	for _, u := range push.URLs {
+		key := NormalizeURL(u)
+		if slices.Contains(seen, key) {
+			continue
+		}
+		seen = append(seen, key)
+
+		list := &repov1alpha1.RepoList{}
+		if err := s.kube.List(ctx, list, client.MatchingFields{FromRepoURLIndex: key}); err != nil {
+			return nil, err
+		}
+		for _, cr := range list.Items {
+			if slices.Contains(push.Branches, cr.Spec.FromRepo.Branch) {
+				res = append(res, cr)
+			}
+		}
+	}
+	return res, nil
+}
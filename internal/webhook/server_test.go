@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	repov1alpha1 "github.com/krateoplatformops/git-provider/apis/repo/v1alpha1"
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestServeHTTP(t *testing.T) {
+	const secret = "s3cr3t"
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, repov1alpha1.SchemeBuilder.AddToScheme(scheme))
+
+	newRepo := func(name, url, branch string) *repov1alpha1.Repo {
+		return &repov1alpha1.Repo{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: repov1alpha1.RepoSpec{
+				FromRepo: repov1alpha1.FromRepoOpts{RepoOpts: repov1alpha1.RepoOpts{Url: url, Branch: branch}},
+			},
+		}
+	}
+	kc := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			newRepo("main", "https://github.com/org/repo.git", "main"),
+			newRepo("ssh", "git@github.com:org/repo", "main"),
+			newRepo("dev", "https://github.com/org/repo", "dev"),
+			newRepo("other", "https://github.com/org/other", "main"),
+		).
+		WithIndex(&repov1alpha1.Repo{}, FromRepoURLIndex, IndexFromRepoURL).
+		Build()
+
+	s := &Server{
+		secret: []byte(secret),
+		kube:   kc,
+		log:    logging.NewNopLogger(),
+		events: make(chan event.GenericEvent, 10),
+	}
+
+	body := `{"ref":"refs/heads/main","repository":{"clone_url":"https://github.com/org/repo.git","ssh_url":"git@github.com:org/repo.git","html_url":"https://github.com/org/repo"}}`
+	send := func(signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, Path, strings.NewReader(body))
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("X-Hub-Signature-256", signature)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("sha256=" + sign(secret, body))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	require.Len(t, s.events, 2)
+	var names []string
+	for len(s.events) > 0 {
+		names = append(names, (<-s.events).Object.GetName())
+	}
+	assert.ElementsMatch(t, []string{"main", "ssh"}, names)
+
+	rec = send("sha256=" + sign("wrong", body))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, s.events)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
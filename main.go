@@ -6,9 +6,14 @@ import (
 	"log/slog"
 	"os"
 	"time"
+	// time zones of the sync schedules, for images without tzdata
+	_ "time/tzdata"
 
+	corev1 "k8s.io/api/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
 	"github.com/go-logr/logr"
 	"github.com/krateoplatformops/git-provider/apis"
@@ -19,6 +24,7 @@ import (
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	github "github.com/krateoplatformops/git-provider/internal/controllers"
+	"github.com/krateoplatformops/git-provider/internal/webhook"
 	"github.com/krateoplatformops/provider-runtime/pkg/controller"
 
 	"github.com/stoewer/go-strcase"
@@ -38,6 +44,7 @@ func main() {
 	leaderElection := flag.Bool("leader-election", env.Bool(fmt.Sprintf("%s_LEADER_ELECTION", envVarPrefix), false), "Use leader election for the controller manager.")
 	maxErrorRetryInterval := flag.Duration("max-error-retry-interval", env.Duration(fmt.Sprintf("%s_MAX_ERROR_RETRY_INTERVAL", envVarPrefix), 1*time.Minute), "The maximum interval between retries when an error occurs. This should be less than the half of the poll interval.")
 	minErrorRetryInterval := flag.Duration("min-error-retry-interval", env.Duration(fmt.Sprintf("%s_MIN_ERROR_RETRY_INTERVAL", envVarPrefix), 1*time.Second), "The minimum interval between retries when an error occurs. This should be less than max-error-retry-interval.")
+	webhookAddress := flag.String("webhook-address", env.String(fmt.Sprintf("%s_WEBHOOK_ADDRESS", envVarPrefix), ""), "Address of the server receiving the push webhooks of the git servers, such as :9443. The server is disabled if empty.")
 	flag.Parse()
 
 	// var zapOptions []zap.Opts
@@ -93,6 +100,12 @@ func main() {
 		Cache: cache.Options{
 			SyncPeriod: syncPeriod,
 		},
+		// ConfigMaps and Secrets are read on demand: caching them would keep every one in the cluster in memory
+		Client: client.Options{
+			Cache: &client.CacheOptions{
+				DisableFor: []client.Object{&corev1.ConfigMap{}, &corev1.Secret{}},
+			},
+		},
 		Metrics: metricsserver.Options{
 			BindAddress: ":8080",
 		},
@@ -113,7 +126,22 @@ func main() {
 		log.Info("Cannot add APIs to scheme", "error", err)
 		os.Exit(1)
 	}
-	if err := github.Setup(mgr, o); err != nil {
+	var triggers <-chan event.GenericEvent
+	if *webhookAddress != "" {
+		// the secret is read only from the environment, to keep it out of the process arguments
+		srv, err := webhook.NewServer(mgr, log, *webhookAddress, os.Getenv(fmt.Sprintf("%s_WEBHOOK_SECRET", envVarPrefix)))
+		if err != nil {
+			log.Info("Cannot setup webhook server", "error", err)
+			os.Exit(1)
+		}
+		if err := mgr.Add(srv); err != nil {
+			log.Info("Cannot add webhook server", "error", err)
+			os.Exit(1)
+		}
+		triggers = srv.Events()
+	}
+
+	if err := github.Setup(mgr, o, triggers); err != nil {
 		log.Info("Cannot setup controllers", "error", err)
 		os.Exit(1)
 	}